@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const maxTimelineSamples = 100
+
+type BitrateSample struct {
+	Time    float64 `json:"time"`
+	Bitrate int64   `json:"bitrate"`
+}
+
+func sampleBitrateTimeline(filePath string, duration float64) ([]BitrateSample, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("unknown duration")
+	}
+
+	buckets := min(maxTimelineSamples, int(math.Ceil(duration)))
+	bucketLength := duration / float64(buckets)
+	bytesPerBucket := make([]int64, buckets)
+
+	cmd := exec.Command(
+		ffprobePath,
+		"-v", "quiet",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,size",
+		"-of", "csv=p=0",
+		filePath,
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach ffprobe pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		ptsField, sizeField, ok := strings.Cut(scanner.Text(), ",")
+		if !ok {
+			continue
+		}
+		pts, err1 := strconv.ParseFloat(ptsField, 64)
+		size, err2 := strconv.ParseInt(strings.TrimSuffix(sizeField, ","), 10, 64)
+		if err1 != nil || err2 != nil || pts < 0 {
+			continue
+		}
+		bucket := min(int(pts/bucketLength), buckets-1)
+		bytesPerBucket[bucket] += size
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	samples := make([]BitrateSample, buckets)
+	for i, size := range bytesPerBucket {
+		samples[i] = BitrateSample{
+			Time:    math.Round(float64(i)*bucketLength*100) / 100,
+			Bitrate: int64(float64(size*8) / bucketLength),
+		}
+	}
+	return samples, nil
+}
+
+// estimateVideoBitrate sums the packet sizes of the first video stream, for
+// containers that don't record a per-stream bit_rate.
+func estimateVideoBitrate(filePath string, duration float64) (int64, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("unknown duration")
+	}
+
+	output, err := exec.Command(
+		ffprobePath,
+		"-v", "quiet",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=size",
+		"-of", "csv=p=0",
+		filePath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	var total int64
+	for _, line := range strings.Split(string(output), "\n") {
+		if size, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(line), ","), 10, 64); err == nil {
+			total += size
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("no video packets found")
+	}
+	return int64(float64(total*8) / duration), nil
+}
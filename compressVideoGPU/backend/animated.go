@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	outputTypeGIF  = "gif"
+	outputTypeWebP = "webp"
+
+	defaultAnimatedFPS   = 10
+	maxAnimatedFPS       = 30
+	defaultAnimatedWidth = 480
+	maxAnimatedWidth     = 1280
+	maxAnimatedDuration  = 30.0
+)
+
+var animatedEncoders = map[string]string{
+	outputTypeGIF:  "gif",
+	outputTypeWebP: "libwebp",
+}
+
+func (o CompressionOptions) animated() bool {
+	return o.OutputType == outputTypeGIF || o.OutputType == outputTypeWebP
+}
+
+func (o CompressionOptions) validateAnimated(sourceDuration float64) error {
+	if !o.animated() {
+		return nil
+	}
+	if clip := o.clipDuration(sourceDuration); clip > maxAnimatedDuration {
+		return fmt.Errorf("%s output is limited to %gs clips, got %ss; trim the input with startTime and duration", o.OutputType, maxAnimatedDuration, formatSeconds(clip))
+	}
+	return nil
+}
+
+// buildAnimatedArgs renders a short looping animation. GIFs get a palette
+// generated from the clip itself (palettegen) that paletteuse then dithers
+// against, which looks far better than ffmpeg's default 256-color palette.
+func buildAnimatedArgs(p encodeParams) []string {
+	args := []string{"-y"}
+	args = append(args, p.Trim...)
+	args = append(args, "-i", p.Input)
+
+	var filters []string
+	if p.ToneMap {
+		filters = append(filters, toneMapFilter)
+	}
+	filters = append(filters, fmt.Sprintf("fps=%d", p.FPS))
+	filters = append(filters, withEnhancement([]string{
+		fmt.Sprintf("scale='min(%d,iw)':-2:flags=lanczos", p.Width),
+	}, p.Denoise, p.Sharpen)...)
+	filters = append(filters, p.ExtraFilters...)
+	graph := strings.Join(filters, ",")
+
+	if p.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(p.Threads))
+	}
+
+	switch p.OutputType {
+	case outputTypeWebP:
+		args = append(args,
+			"-vf", graph,
+			"-c:v", animatedEncoders[outputTypeWebP],
+			"-lossless", "0",
+			"-q:v", "75",
+			"-loop", "0",
+			"-an",
+			"-f", "webp",
+		)
+	default:
+		args = append(args,
+			"-vf", graph+",split[s0][s1];[s0]palettegen=stats_mode=diff[p];[s1][p]paletteuse=dither=bayer:bayer_scale=5",
+			"-loop", "0",
+			"-an",
+			"-f", "gif",
+		)
+	}
+	return append(args, p.Output)
+}
+
+// animatedOutputMetrics covers ffprobe builds that cannot decode animated
+// WebP; only the file size is known then.
+func animatedOutputMetrics(outputPath, outputType string) (*VideoMetrics, error) {
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	return &VideoMetrics{VideoCodec: outputType, Size: info.Size()}, nil
+}
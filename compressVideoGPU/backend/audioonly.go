@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+
+const (
+	outputTypeAudio    = "audio"
+	defaultAudioFormat = "mp3"
+)
+
+type audioFormat struct {
+	Encoder string
+	Muxer   string
+}
+
+// audioFormats maps the audioFormat option to its encoder and muxer. The
+// format name doubles as the file extension; m4a is MP4 audio, written with
+// the ipod muxer so players recognise it.
+var audioFormats = map[string]audioFormat{
+	"mp3":  {Encoder: "libmp3lame", Muxer: "mp3"},
+	"m4a":  {Encoder: "aac", Muxer: "ipod"},
+	"opus": {Encoder: "libopus", Muxer: "opus"},
+}
+
+func (o CompressionOptions) audioOnly() bool {
+	return o.OutputType == outputTypeAudio
+}
+
+func (o CompressionOptions) validateAudioOutput(source *VideoMetrics) error {
+	if o.audioOnly() && source.AudioCodec == "" {
+		return fmt.Errorf("the source has no audio stream to extract")
+	}
+	return nil
+}
+
+// buildAudioArgs extracts a single audio track, the default one unless
+// audioTracks picked another, and drops everything else.
+func buildAudioArgs(p encodeParams) []string {
+	args := []string{"-y"}
+	args = append(args, p.Trim...)
+	args = append(args, "-i", p.Input, "-vn", "-sn", "-dn")
+
+	track := 0
+	if len(p.AudioLayout) > 0 {
+		track = p.AudioLayout[0].Index
+	}
+	args = append(args, "-map", fmt.Sprintf("0:a:%d", track), "-c:a", p.Encoder)
+
+	audioBitrate := p.AudioBitrate
+	if audioBitrate == "" {
+		audioBitrate = settings.AudioBitrate
+	}
+	if audioBitrate != "" {
+		args = append(args, "-b:a", audioBitrate)
+	}
+	if p.AudioFilter != "" {
+		args = append(args, "-af", p.AudioFilter, "-ar", loudnessSampleRate)
+	}
+	return append(args, "-f", audioFormats[p.AudioFormat].Muxer, p.Output)
+}
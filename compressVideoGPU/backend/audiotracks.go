@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxAudioTrackSelections = 16
+
+const (
+	audioModeCopy     = "copy"
+	audioModeStrip    = "strip"
+	audioModeReencode = "reencode"
+)
+
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}$`)
+
+type AudioTrack struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+func parseAudioTrackSelection(value string) ([]string, error) {
+	var selectors []string
+	for _, selector := range strings.Split(value, ",") {
+		selector = strings.ToLower(strings.TrimSpace(selector))
+		if selector == "" {
+			continue
+		}
+		if index, err := strconv.Atoi(selector); err == nil {
+			if index < 0 {
+				return nil, fmt.Errorf("track index must not be negative, got %d", index)
+			}
+		} else if !languagePattern.MatchString(selector) {
+			return nil, fmt.Errorf("%q is neither a track index nor a language code", selector)
+		}
+		selectors = append(selectors, selector)
+	}
+
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no audio tracks selected")
+	}
+	if len(selectors) > maxAudioTrackSelections {
+		return nil, fmt.Errorf("at most %d audio tracks can be selected", maxAudioTrackSelections)
+	}
+	return selectors, nil
+}
+
+func resolveAudioTracks(selectors []string, available []AudioTrack) ([]AudioTrack, error) {
+	var selected []AudioTrack
+	seen := make(map[int]bool)
+
+	for _, selector := range selectors {
+		matched := false
+		for _, track := range available {
+			if strconv.Itoa(track.Index) != selector && !strings.EqualFold(track.Language, selector) {
+				continue
+			}
+			matched = true
+			if !seen[track.Index] {
+				seen[track.Index] = true
+				selected = append(selected, track)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("audio track %q not found in source", selector)
+		}
+	}
+
+	for i := range selected {
+		selected[i].Default = i == 0
+	}
+	return selected, nil
+}
+
+func audioTrackArgs(tracks []AudioTrack, videoMap string) []string {
+	args := []string{"-map", videoMap}
+	for _, track := range tracks {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d", track.Index))
+	}
+	for i, track := range tracks {
+		disposition := "0"
+		if track.Default {
+			disposition = "default"
+		}
+		args = append(args, fmt.Sprintf("-disposition:a:%d", i), disposition)
+	}
+	return args
+}
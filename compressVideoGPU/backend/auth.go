@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadAPIKeys returns nil when no keys are configured and authentication is
+// disabled with AUTH_DISABLED. Configured keys are always enforced, so a
+// deployment that defaults AUTH_DISABLED on only runs open until keys are set.
+func loadAPIKeys() ([]string, error) {
+	disabled := false
+	if value := os.Getenv("AUTH_DISABLED"); value != "" {
+		var err error
+		disabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_DISABLED %q: %v", value, err)
+		}
+	}
+
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API_KEYS_FILE: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		if disabled {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no API keys configured; set API_KEYS or API_KEYS_FILE, or AUTH_DISABLED=true for local development")
+	}
+	return keys, nil
+}
+
+func validAPIKey(keys []string, candidate string) bool {
+	valid := false
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func apiKeyMiddleware(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if keys == nil {
+			c.Next()
+			return
+		}
+
+		key := c.GetHeader("X-API-Key")
+		if key == "" || !validAPIKey(keys, key) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing API key",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
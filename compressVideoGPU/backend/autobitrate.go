@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	bitrateAuto        = "auto"
+	defaultQualityTier = "medium"
+
+	minAutoBitrate = 300_000
+	maxAutoBitrate = 50_000_000
+	// autoFallbackFPS stands in for sources whose frame rate ffprobe can't
+	// tell.
+	autoFallbackFPS = 30.0
+)
+
+// qualityTierBitsPerPixel is the H.264 bit budget per pixel and frame of
+// each tier. These are rules of thumb, not measurements of the content:
+// 0.08 gives 1080p30 about 5Mbps.
+var qualityTierBitsPerPixel = map[string]float64{
+	"low":    0.05,
+	"medium": 0.08,
+	"high":   0.12,
+}
+
+// autoCodecEfficiency scales the budget for encoders that reach the same
+// quality at a lower bitrate than H.264, keyed by the encoder that actually
+// runs, so the CPU fallbacks get the factor of their codec.
+var autoCodecEfficiency = map[string]float64{
+	"hevc_nvenc": 0.7,
+	"libx265":    0.7,
+	"av1_nvenc":  0.55,
+	"libsvtav1":  0.55,
+}
+
+func (o CompressionOptions) autoBitrate() bool {
+	return o.Bitrate == bitrateAuto
+}
+
+// autoBitrateFor derives a bitrate for encoder from the output size and frame
+// rate for bitrate=auto, and describes how it got there for the metrics. The
+// result never exceeds the source video bitrate, since re-encoding can't add
+// detail.
+func (o CompressionOptions) autoBitrateFor(encoder string, source *VideoMetrics, outputHeight int) (string, string) {
+	fps, _ := strconv.ParseFloat(source.FrameRate, 64)
+	if o.TargetFPS > 0 {
+		fps = o.TargetFPS
+	}
+	if fps <= 0 {
+		fps = autoFallbackFPS
+	}
+	width := scaledWidth(source.Width, source.Height, outputHeight)
+	bitsPerPixel := qualityTierBitsPerPixel[o.QualityTier]
+	efficiency, ok := autoCodecEfficiency[encoder]
+	if !ok {
+		efficiency = 1
+	}
+
+	bits := int64(float64(width*outputHeight) * fps * bitsPerPixel * efficiency)
+	bits = min(max(bits, minAutoBitrate), maxAutoBitrate)
+	heuristic := fmt.Sprintf("%s tier: %dx%d at %.2ffps x %g bits per pixel x %g for %s = %dk",
+		o.QualityTier, width, outputHeight, fps, bitsPerPixel, efficiency, encoder, bits/1000)
+	if source.VideoBitrate > 0 && bits > source.VideoBitrate {
+		bits = max(source.VideoBitrate, minAutoBitrate)
+		heuristic += fmt.Sprintf(", capped at the source video bitrate of %dk", bits/1000)
+	}
+	return fmt.Sprintf("%dk", bits/1000), heuristic
+}
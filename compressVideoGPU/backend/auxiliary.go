@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	audioVisualWaveform    = "waveform"
+	audioVisualSpectrogram = "spectrogram"
+
+	thumbnailPosition = 0.1
+	thumbnailEndGuard = 0.5
+)
+
+func runAuxiliaryTask(args ...string) error {
+	output := newTailBuffer(ffmpegLogTailSize)
+	cmd := exec.Command(ffmpegPath, append([]string{"-y", "-v", "error"}, args...)...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, string(output.Bytes()))
+	}
+	return nil
+}
+
+func generateAudioVisual(jobID, inputPath, kind string) (string, error) {
+	filter := "showwavespic=s=1280x240:split_channels=1"
+	if kind == audioVisualSpectrogram {
+		filter = "showspectrumpic=s=1280x512:legend=1"
+	}
+
+	filename := fmt.Sprintf("%s_waveform.png", jobID)
+	err := runAuxiliaryTask(
+		"-i", inputPath,
+		"-filter_complex", "[0:a:0]"+filter,
+		"-frames:v", "1",
+		filepath.Join(staticDir, filename),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return "/static/" + filename, nil
+}
+
+func thumbnailTimestamp(duration float64) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return max(0, min(duration*thumbnailPosition, duration-thumbnailEndGuard))
+}
+
+// thumbnailArgs extracts one frame at seek. rotation is the display rotation
+// of videoPath; the frame is transposed explicitly instead of relying on
+// ffmpeg's autorotation, which depends on the version and on how the rotation
+// is stored, so the poster is upright like the video.
+func thumbnailArgs(videoPath, thumbPath string, seek float64, rotation int) []string {
+	args := []string{"-ss", strconv.FormatFloat(seek, 'f', 3, 64)}
+	filter := rotationFilter(rotation)
+	if filter != "" {
+		args = append(args, "-noautorotate")
+	}
+	args = append(args, "-i", videoPath)
+	if filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	return append(args, "-frames:v", "1", "-q:v", "2", thumbPath)
+}
+
+func generateThumbnail(jobID, videoPath string, duration float64, rotation int) (string, error) {
+	filename := fmt.Sprintf("%s_thumb.jpg", jobID)
+	thumbPath := filepath.Join(staticDir, filename)
+
+	for _, seek := range []float64{thumbnailTimestamp(duration), 0} {
+		err := runAuxiliaryTask(thumbnailArgs(videoPath, thumbPath, seek, rotation)...)
+		if err != nil {
+			return "", err
+		}
+
+		// Seeking past the last decodable frame succeeds without writing anything.
+		if info, err := os.Stat(thumbPath); err == nil && info.Size() > 0 {
+			return "/static/" + filename, nil
+		}
+		if seek == 0 {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("no frame could be extracted from %s", filepath.Base(videoPath))
+}
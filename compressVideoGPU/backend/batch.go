@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchFiles = 20
+
+func batchJobs(batchID string) []string {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+
+	var jobIDs []string
+	for jobID, job := range jobsByID {
+		if job.Batch == batchID {
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+	slices.SortFunc(jobIDs, func(a, b string) int {
+		return jobsByID[a].Created.Compare(jobsByID[b].Created)
+	})
+	return jobIDs
+}
+
+func batchStatus(counts map[string]int, total int) string {
+	switch {
+	case counts["queued"]+counts["processing"] > 0:
+		return "processing"
+	case counts["complete"] == total:
+		return "complete"
+	case counts["complete"] > 0:
+		return "partial"
+	default:
+		return "failed"
+	}
+}
+
+func handleBatch(c *gin.Context) {
+	batchID := c.Param("batchID")
+
+	jobIDs := batchJobs(batchID)
+	if len(jobIDs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Batch ID not found",
+		})
+		return
+	}
+
+	counts := make(map[string]int)
+	jobs := make([]gin.H, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		status := getJobStatus(jobID)
+		counts[status]++
+		jobs = append(jobs, jobStatusResponse(jobID, status))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batchID": batchID,
+		"status":  batchStatus(counts, len(jobIDs)),
+		"counts":  counts,
+		"jobs":    jobs,
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+var (
+	ffmpegPath  = "ffmpeg"
+	ffprobePath = "ffprobe"
+)
+
+// binaryConfig reads FFMPEG_PATH and FFPROBE_PATH, for static builds that
+// are not on PATH. A configured binary must resolve to an executable; a
+// default one that is missing is only logged, and /ready reports it.
+func binaryConfig() (string, string, error) {
+	ffmpeg, err := binaryPath("FFMPEG_PATH", ffmpegPath)
+	if err != nil {
+		return "", "", err
+	}
+	ffprobe, err := binaryPath("FFPROBE_PATH", ffprobePath)
+	if err != nil {
+		return "", "", err
+	}
+	return ffmpeg, ffprobe, nil
+}
+
+func binaryPath(env, fallback string) (string, error) {
+	path := os.Getenv(env)
+	if path == "" {
+		if _, err := exec.LookPath(fallback); err != nil {
+			slog.Warn("Binary not found, jobs will fail until it is installed", "binary", fallback, "error", err)
+		}
+		return fallback, nil
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return "", fmt.Errorf("%s %q is not an executable: %v", env, path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import "strings"
+
+const highBitDepth = 10
+
+// tenBitArgs selects the 10-bit Main10 profile. NVENC takes P010 frames
+// directly, libx265 (the CPU fallback) wants planar 10-bit input.
+func tenBitArgs(encoder string) []string {
+	pixFmt := "yuv420p10le"
+	if isNVENC(encoder) {
+		pixFmt = "p010le"
+	}
+	return []string{"-pix_fmt", pixFmt, "-profile:v", "main10"}
+}
+
+// pixelFormatBitDepth derives the bits per component from an ffmpeg pixel
+// format name such as yuv420p10le or p010le, or returns 0 when the format is
+// unknown.
+func pixelFormatBitDepth(pixelFormat string) int {
+	switch {
+	case pixelFormat == "":
+		return 0
+	case pixelFormat == "p010le" || pixelFormat == "p010be" || strings.Contains(pixelFormat, "p10"):
+		return 10
+	case pixelFormat == "p016le" || strings.Contains(pixelFormat, "p16"):
+		return 16
+	case strings.Contains(pixelFormat, "p12"):
+		return 12
+	default:
+		return 8
+	}
+}
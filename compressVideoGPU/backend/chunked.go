@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type chunkedUpload struct {
+	mu       sync.Mutex
+	ID       string
+	JobID    string
+	Filename string
+	Size     int64
+	Offset   int64
+	Options  CompressionOptions
+	Updated  time.Time
+}
+
+func (u *chunkedUpload) partPath() string {
+	return filepath.Join(uploadDir, fmt.Sprintf("%s_upload.part", u.JobID))
+}
+
+var (
+	chunkedUploads = make(map[string]*chunkedUpload)
+	uploadsMutex   sync.Mutex
+)
+
+func getChunkedUpload(uploadID string) *chunkedUpload {
+	uploadsMutex.Lock()
+	defer uploadsMutex.Unlock()
+	return chunkedUploads[uploadID]
+}
+
+func removeChunkedUpload(upload *chunkedUpload) {
+	uploadsMutex.Lock()
+	delete(chunkedUploads, upload.ID)
+	uploadsMutex.Unlock()
+}
+
+func handleUploadInit(c *gin.Context) {
+	filename := c.PostForm("filename")
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "filename is required",
+		})
+		return
+	}
+	if err := checkFilenameExtension(filename); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid file extension",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	size, err := strconv.ParseInt(c.PostForm("size"), 10, 64)
+	if err != nil || size <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "size must be the total file size in bytes",
+		})
+		return
+	}
+	if size > maxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("File too large. Maximum size is %dMB", maxFileSize/(1024*1024)),
+		})
+		return
+	}
+
+	opts, ok := bindCompressionOptions(c)
+	if !ok {
+		return
+	}
+
+	upload := &chunkedUpload{
+		ID:       uuid.New().String(),
+		JobID:    uuid.New().String(),
+		Filename: filename,
+		Size:     size,
+		Options:  opts,
+		Updated:  time.Now(),
+	}
+
+	file, err := os.Create(upload.partPath())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create upload",
+			"details": err.Error(),
+		})
+		return
+	}
+	file.Close()
+
+	uploadsMutex.Lock()
+	chunkedUploads[upload.ID] = upload
+	uploadsMutex.Unlock()
+
+	slog.Info("Chunked upload started", "event", "upload_started", "uploadID", upload.ID, "filename", filename, "size", size)
+
+	c.JSON(http.StatusOK, gin.H{
+		"uploadID": upload.ID,
+		"offset":   0,
+		"size":     size,
+	})
+}
+
+func handleUploadOffset(c *gin.Context) {
+	upload := getChunkedUpload(c.Param("uploadID"))
+	if upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload ID not found",
+		})
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"uploadID": upload.ID,
+		"offset":   upload.Offset,
+		"size":     upload.Size,
+	})
+}
+
+func handleUploadChunk(c *gin.Context) {
+	upload := getChunkedUpload(c.Param("uploadID"))
+	if upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload ID not found",
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Upload-Offset header must be the byte offset of this chunk",
+		})
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  fmt.Sprintf("Chunk offset %d does not match the received offset", offset),
+			"offset": upload.Offset,
+		})
+		return
+	}
+
+	file, err := os.OpenFile(upload.partPath(), os.O_WRONLY, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to open upload",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to write chunk",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	remaining := upload.Size - upload.Offset
+	written, err := io.Copy(file, io.LimitReader(c.Request.Body, remaining+1))
+	if written > remaining {
+		file.Truncate(upload.Offset)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":  "Chunk extends past the declared upload size",
+			"offset": upload.Offset,
+		})
+		return
+	}
+
+	// Keep whatever arrived before a dropped connection so the client can resume from it.
+	upload.Offset += written
+	upload.Updated = time.Now()
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to write chunk",
+			"details": err.Error(),
+			"offset":  upload.Offset,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uploadID": upload.ID,
+		"offset":   upload.Offset,
+		"size":     upload.Size,
+	})
+}
+
+func handleUploadComplete(c *gin.Context) {
+	upload := getChunkedUpload(c.Param("uploadID"))
+	if upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload ID not found",
+		})
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	if upload.Offset != upload.Size {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  fmt.Sprintf("Upload is incomplete: received %d of %d bytes", upload.Offset, upload.Size),
+			"offset": upload.Offset,
+		})
+		return
+	}
+
+	removeChunkedUpload(upload)
+
+	contentType, err := detectVideoFile(upload.partPath())
+	if err != nil {
+		os.Remove(upload.partPath())
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid file type",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ext := videoExtension(upload.Filename, contentType)
+	inputPath := filepath.Join(uploadDir, fmt.Sprintf("%s_input%s", upload.JobID, ext))
+	if err := os.Rename(upload.partPath(), inputPath); err != nil {
+		os.Remove(upload.partPath())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to assemble upload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Chunks can be resent after an interruption, so the input is hashed
+	// once it is complete rather than while the chunks arrive.
+	inputHash, err := hashFile(inputPath)
+	if err != nil {
+		os.Remove(inputPath)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to assemble upload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	queueUploadedJob(c, upload.JobID, inputPath, upload.Filename, upload.Size, upload.Options, inputHash)
+}
+
+func cleanupStaleUploads(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+
+	uploadsMutex.Lock()
+	var stale []*chunkedUpload
+	for _, upload := range chunkedUploads {
+		if upload.mu.TryLock() {
+			if upload.Updated.Before(cutoff) {
+				stale = append(stale, upload)
+				delete(chunkedUploads, upload.ID)
+			}
+			upload.mu.Unlock()
+		}
+	}
+	uploadsMutex.Unlock()
+
+	for _, upload := range stale {
+		if err := os.Remove(upload.partPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Janitor failed to remove file", "path", upload.partPath(), "error", err)
+		}
+		slog.Info("Janitor removed stale chunked upload", "event", "janitor", "uploadID", upload.ID)
+	}
+}
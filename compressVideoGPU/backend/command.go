@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const previewJobID = "preview"
+
+// ffmpegEnv holds the file paths of a job and the host capabilities, so that
+// buildFFmpegArgs never has to touch the filesystem or probe ffmpeg itself.
+type ffmpegEnv struct {
+	Input           string
+	NormalizedInput string
+	Output          string
+	TextFile        string
+	Overlay         string
+	PassLog         string
+	GPUAvailable    bool
+	ToneMapping     bool
+}
+
+// ffmpegPlan is the outcome of buildFFmpegArgs: the encode parameters plus the
+// decisions taken on the way, which end up in the job metrics.
+type ffmpegPlan struct {
+	Params            encodeParams
+	Normalize         []string
+	LoudnessMeasure   []string
+	TargetHeight      int
+	Decision          string
+	MaxHeightDecision string
+	Warning           string
+	ClipDuration      float64
+	AudioLayout       []AudioTrack
+	VideoStream       int
+	RateControl       string
+	ToneMapReason     string
+	NormalizeReason   string
+	PixelFormatReason string
+	BitrateHeuristic  string
+	CPUFallback       bool
+}
+
+type ffmpegStep struct {
+	Phase string   `json:"phase"`
+	Args  []string `json:"args"`
+}
+
+func buildFFmpegArgs(opts CompressionOptions, source *VideoMetrics, env ffmpegEnv) (*ffmpegPlan, error) {
+	plan := &ffmpegPlan{}
+
+	targetHeight, decision, err := resolveTargetHeight(opts.TargetHeight, source)
+	if err != nil {
+		return nil, err
+	}
+	plan.Decision = decision
+	plan.TargetHeight, plan.MaxHeightDecision = capTargetHeight(targetHeight, opts.MaxHeight, source)
+
+	if err := opts.validateTrim(source.Duration); err != nil {
+		return nil, err
+	}
+	plan.ClipDuration = opts.clipDuration(source.Duration)
+
+	if err := opts.validateTargetFPS(source.FrameRate); err != nil {
+		return nil, err
+	}
+
+	gopFrames, gopSeconds, err := opts.gopFrames(source.FrameRate)
+	if err != nil {
+		return nil, err
+	}
+
+	subtitleTrack, err := opts.subtitleTrack(source.SubtitleTracks)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.AudioTracks) > 0 {
+		plan.AudioLayout, err = resolveAudioTracks(opts.AudioTracks, source.AudioTracks)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Streams) > 0 {
+		selection, err := resolveStreams(opts.Streams, source.Streams)
+		if err != nil {
+			return nil, err
+		}
+		plan.AudioLayout, plan.VideoStream = selection.Audio, selection.Video
+		if opts.TwoPassAudio && len(plan.AudioLayout) > 1 {
+			return nil, fmt.Errorf("twoPassAudio measures a single audio track, but the streams selection keeps %d", len(plan.AudioLayout))
+		}
+	}
+
+	encodeInput, sourceCodec := env.Input, source.VideoCodec
+	if opts.ToneMap && env.ToneMapping {
+		plan.ToneMapReason = hdrReason(source)
+	}
+
+	if settings.NormalizeInputs && !opts.Lossless && !opts.remux() && !opts.audioOnly() && plan.ToneMapReason == "" {
+		plan.NormalizeReason = normalizationReason(source)
+	}
+	if plan.NormalizeReason != "" {
+		plan.Normalize = normalizeArgs(env.Input, env.NormalizedInput, plan.VideoStream, source, opts.BitDepth)
+		encodeInput, sourceCodec = env.NormalizedInput, "ffv1"
+	}
+
+	// A 10-bit intermediate is checked like a 10-bit source.
+	encodePixelFormat := source.PixelFormat
+	if plan.NormalizeReason != "" {
+		encodePixelFormat = normalizedPixelFormat(source, opts.BitDepth)
+	}
+	if settings.CompatiblePixelFormat && plan.ToneMapReason == "" && opts.BitDepth != highBitDepth &&
+		!opts.Lossless && !opts.remux() && !opts.animated() && !opts.audioOnly() {
+		plan.PixelFormatReason = compatiblePixelFormatReason(encodePixelFormat)
+	}
+
+	encoder := opts.Codec
+	switch {
+	case opts.remux():
+		encoder = "copy"
+		err = validateRemuxContainer(opts.container(), source.VideoCodec)
+	case opts.animated():
+		encoder = animatedEncoders[opts.OutputType]
+	case opts.audioOnly():
+		encoder = audioFormats[opts.AudioFormat].Encoder
+	case opts.hls():
+		if isNVENC(encoder) && !env.GPUAvailable {
+			encoder, plan.CPUFallback = cpuFallbackEncoder(encoder), true
+		}
+	default:
+		if isNVENC(encoder) && !env.GPUAvailable {
+			encoder, plan.CPUFallback = cpuFallbackEncoder(encoder), true
+		}
+		err = validateContainer(opts.container(), encoder, opts.Fragmented)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var extraFilters []string
+	if opts.VideoFilter != "" {
+		extraFilters = append(extraFilters, opts.VideoFilter)
+	}
+	if subtitleTrack != nil && opts.Subtitles == subtitleModeBurn {
+		extraFilters = append(extraFilters, burnSubtitlesFilter(env.Input, subtitleTrack.Index, opts.StartTime))
+	}
+	if opts.TextWatermark != nil {
+		extraFilters = append(extraFilters, drawTextFilter(env.TextFile, opts.TextWatermark))
+	}
+
+	overlayPosition := ""
+	if opts.ImageWatermark != nil {
+		overlayPosition = opts.ImageWatermark.Position
+	}
+
+	outputHeight := source.Height
+	if plan.TargetHeight > 0 {
+		outputHeight = plan.TargetHeight
+	}
+
+	bitrate := opts.Bitrate
+	if opts.autoBitrate() {
+		bitrate, plan.BitrateHeuristic = opts.autoBitrateFor(encoder, source, outputHeight)
+	}
+	if opts.TargetSizeMB > 0 {
+		bits, warning, err := opts.targetSizeBitrate(source, plan.ClipDuration, outputHeight)
+		if err != nil {
+			return nil, err
+		}
+		bitrate, plan.Warning = fmt.Sprintf("%dk", bits/1000), warning
+	}
+	if bitrate == "" {
+		bitrate = settings.videoBitrateFor(outputHeight)
+	}
+	if err := opts.validateMaxrate(bitrate); err != nil {
+		return nil, err
+	}
+
+	rateControl, crf := "bitrate", opts.CRF
+	switch {
+	case opts.Lossless:
+		rateControl, bitrate, crf = "lossless", "", nil
+	case crf != nil:
+		rateControl, bitrate = "crf", ""
+	case opts.animated(), opts.audioOnly():
+		rateControl, bitrate = opts.OutputType, ""
+	case opts.remux():
+		rateControl, bitrate = "copy", ""
+	case opts.hls():
+		rateControl, bitrate = modeHLS, ""
+	}
+	plan.RateControl = rateControl
+
+	gpuScaling := plan.TargetHeight > 0 && !opts.hls() && plan.TargetHeight < source.Height && !opts.Lossless &&
+		len(extraFilters) == 0 && env.Overlay == "" && opts.Denoise == "" && !opts.Sharpen && source.Rotation == 0 && plan.ToneMapReason == "" && plan.PixelFormatReason == "" && opts.BitDepth != highBitDepth &&
+		isNVENC(encoder) && supportsGPUDecodeScaling(sourceCodec)
+
+	plan.Params = encodeParams{
+		Input:         encodeInput,
+		Output:        env.Output,
+		Encoder:       encoder,
+		GPUScaling:    gpuScaling,
+		TargetHeight:  plan.TargetHeight,
+		Bitrate:       bitrate,
+		Maxrate:       opts.Maxrate,
+		Bufsize:       opts.Bufsize,
+		CRF:           crf,
+		ExtraFilters:  extraFilters,
+		AudioLayout:   plan.AudioLayout,
+		Streams:       opts.Streams,
+		VideoStream:   plan.VideoStream,
+		Lossless:      opts.Lossless,
+		SourcePixFmt:  source.PixelFormat,
+		Fragmented:    opts.Fragmented,
+		Container:     opts.container(),
+		TwoPass:       rateControl == "bitrate" && opts.TwoPass && supportsTwoPass(encoder),
+		AudioMode:     opts.AudioMode,
+		AudioBitrate:  opts.AudioBitrate,
+		AudioCodec:    opts.AudioCodec,
+		Preset:        opts.Preset,
+		ToneMap:       plan.ToneMapReason != "",
+		Overlay:       env.Overlay,
+		OverlayPos:    overlayPosition,
+		Trim:          opts.trimInputArgs(),
+		OutputType:    opts.OutputType,
+		AudioFormat:   opts.AudioFormat,
+		TargetFPS:     opts.TargetFPS,
+		Remux:         opts.remux(),
+		StripMetadata: opts.StripMetadata,
+		FPS:           opts.FPS,
+		Width:         opts.Width,
+		PassLog:       env.PassLog,
+		GOP:           gopFrames,
+		GOPSeconds:    gopSeconds,
+		Denoise:       opts.denoiseFilter(),
+		Sharpen:       opts.sharpenFilter(),
+		BitDepth:      opts.BitDepth,
+		Rotated:       source.Rotation != 0 && plan.NormalizeReason == "" && !opts.remux(),
+	}
+	if plan.PixelFormatReason != "" {
+		plan.Params.PixelFormat = "yuv420p"
+	}
+	// The normalized copy only contains the selected video stream.
+	if plan.NormalizeReason != "" {
+		plan.Params.VideoStream = 0
+	}
+	if opts.hls() {
+		plan.Params.Renditions = hlsLadder(source.Height, opts.MaxHeight)
+		if source.AudioCodec == "" {
+			plan.Params.AudioMode = audioModeStrip
+		}
+		// Without an explicit interval, keyframes still have to line up with
+		// the segment boundaries of every rendition.
+		if !opts.keyframeControl() {
+			segments := opts
+			segments.KeyframeInterval = hlsSegmentSeconds
+			plan.Params.GOP, plan.Params.GOPSeconds, err = segments.gopFrames(source.FrameRate)
+			if err != nil {
+				return nil, fmt.Errorf("cannot align keyframes with the %gs HLS segments: %v", hlsSegmentSeconds, err)
+			}
+		}
+	}
+	if opts.AudioNormalize && source.AudioCodec != "" && (len(opts.Streams) == 0 || len(plan.AudioLayout) > 0) {
+		plan.Params.AudioFilter = loudnormFilter(opts.LoudnessTarget, nil)
+		if opts.TwoPassAudio {
+			plan.LoudnessMeasure = loudnessMeasureArgs(env.Input, opts.trimInputArgs(), plan.AudioLayout, opts.LoudnessTarget)
+		}
+	}
+	if subtitleTrack != nil {
+		if opts.Subtitles == subtitleModeCopy {
+			plan.Params.SubtitleCopy = &subtitleTrack.Index
+			plan.Params.SubtitleCodec, _ = containerSubtitleCodec(opts.container(), *subtitleTrack)
+		} else {
+			plan.Params.BurnSubtitles = true
+		}
+	}
+	if !isNVENC(encoder) && !opts.remux() && !opts.audioOnly() {
+		plan.Params.Threads = settings.cpuThreadsFor(opts.Threads)
+	}
+	return plan, nil
+}
+
+// commands lists the ffmpeg invocations of the plan in the order runEncode
+// would start them, without the progress flags added at run time.
+func (p *ffmpegPlan) commands() []ffmpegStep {
+	var commands []ffmpegStep
+	if p.Normalize != nil {
+		commands = append(commands, ffmpegStep{Phase: phaseNormalizing, Args: p.Normalize})
+	}
+	if p.LoudnessMeasure != nil {
+		commands = append(commands, ffmpegStep{Phase: phaseLoudness, Args: p.LoudnessMeasure})
+	}
+	if p.Params.TwoPass && !isNVENC(p.Params.Encoder) {
+		first := p.Params
+		first.Pass = 1
+		args, _ := buildEncodeArgs(first)
+		commands = append(commands, ffmpegStep{Phase: phaseFirstPass, Args: args})
+
+		second := p.Params
+		second.Pass = 2
+		args, _ = buildEncodeArgs(second)
+		return append(commands, ffmpegStep{Phase: phaseEncoding, Args: args})
+	}
+	args, _ := buildEncodeArgs(p.Params)
+	return append(commands, ffmpegStep{Phase: phaseEncoding, Args: args})
+}
+
+// previewSource describes the input assumed by /preview-command. The source
+// fields override the defaults, and the audio and subtitle tracks the options
+// select are assumed to exist. Selected streams are assumed to be a video
+// stream at index 0 followed by audio streams.
+func previewSource(c *gin.Context, opts CompressionOptions) (*VideoMetrics, error) {
+	source := &VideoMetrics{
+		Width:       1920,
+		Height:      1080,
+		Duration:    60,
+		VideoCodec:  "h264",
+		AudioCodec:  "aac",
+		FrameRate:   "30",
+		PixelFormat: "yuv420p",
+		ColorSpace:  "bt709",
+		AudioTracks: []AudioTrack{{Index: 0, Codec: "aac", Channels: 2, Default: true}},
+	}
+
+	for field, target := range map[string]*int{"sourceWidth": &source.Width, "sourceHeight": &source.Height} {
+		if value := c.PostForm(field); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive number of pixels", field, value)
+			}
+			*target = n
+		}
+	}
+	if value := c.PostForm("sourceDuration"); value != "" {
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid sourceDuration %q: must be a positive number of seconds", value)
+		}
+		source.Duration = duration
+	}
+	if value := c.PostForm("sourceFrameRate"); value != "" {
+		source.FrameRate = parseFrameRate(value)
+		if source.FrameRate == "" {
+			return nil, fmt.Errorf("invalid sourceFrameRate %q", value)
+		}
+	}
+	if value := c.PostForm("sourceCodec"); value != "" {
+		source.VideoCodec = strings.ToLower(value)
+	}
+	if value := c.PostForm("sourcePixelFormat"); value != "" {
+		source.PixelFormat = strings.ToLower(value)
+	}
+	if value := c.PostForm("sourceRotation"); value != "" {
+		rotation, err := strconv.Atoi(value)
+		if err != nil || rotation%90 != 0 {
+			return nil, fmt.Errorf("invalid sourceRotation %q: must be a multiple of 90 degrees", value)
+		}
+		source.Rotation = probeRotation(nil, map[string]string{"rotate": value})
+	}
+
+	for _, selector := range opts.AudioTracks {
+		if index, err := strconv.Atoi(selector); err == nil {
+			for len(source.AudioTracks) <= index {
+				source.AudioTracks = append(source.AudioTracks, AudioTrack{Index: len(source.AudioTracks), Codec: "aac", Channels: 2})
+			}
+		} else {
+			source.AudioTracks = append(source.AudioTracks, AudioTrack{Index: len(source.AudioTracks), Codec: "aac", Language: selector, Channels: 2})
+		}
+	}
+	if len(opts.Streams) > 0 {
+		source.Streams = []StreamInfo{{Index: 0, Type: "video", Codec: source.VideoCodec}}
+		for len(source.Streams) <= slices.Max(opts.Streams) {
+			source.Streams = append(source.Streams, StreamInfo{Index: len(source.Streams), Type: "audio", Codec: "aac"})
+		}
+	}
+	if opts.Subtitles != "" {
+		for len(source.SubtitleTracks) <= opts.SubtitleTrack {
+			source.SubtitleTracks = append(source.SubtitleTracks, SubtitleTrack{Index: len(source.SubtitleTracks), Codec: "subrip"})
+		}
+	}
+	return source, nil
+}
+
+func handlePreviewCommand(c *gin.Context) {
+	opts, ok := bindCompressionOptions(c)
+	if !ok {
+		return
+	}
+
+	source, err := previewSource(c, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid source description",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	plan, err := buildFFmpegArgs(opts, source, ffmpegEnv{
+		Input:           filepath.Join(uploadDir, previewJobID+"_input.mp4"),
+		NormalizedInput: normalizedInputPath(previewJobID),
+		Output:          filepath.Join(staticDir, outputFilename(previewJobID, opts)),
+		TextFile:        watermarkTextPath(previewJobID),
+		PassLog:         passLogPath(previewJobID),
+		GPUAvailable:    gpuAvailable(),
+		ToneMapping:     supportsToneMapping(),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid compression options",
+			"details": err.Error(),
+			"source":  source,
+		})
+		return
+	}
+
+	niceness := 0
+	if !isNVENC(plan.Params.Encoder) {
+		niceness = settings.CPUNiceness
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"source":             source,
+		"encoder":            plan.Params.Encoder,
+		"encoderType":        encoderType(plan.Params.Encoder),
+		"rateControl":        plan.RateControl,
+		"resolutionDecision": plan.Decision,
+		"maxHeightDecision":  plan.MaxHeightDecision,
+		"normalizeReason":    plan.NormalizeReason,
+		"warning":            plan.Warning,
+		"niceness":           niceness,
+		"commands":           plan.commands(),
+	})
+}
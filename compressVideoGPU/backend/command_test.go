@@ -0,0 +1,110 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func tenBitSource() *VideoMetrics {
+	return &VideoMetrics{
+		Width:       3840,
+		Height:      2160,
+		Duration:    10,
+		VideoCodec:  "hevc",
+		FrameRate:   "30",
+		PixelFormat: "yuv420p10le",
+		BitDepth:    10,
+		ColorSpace:  "bt709",
+	}
+}
+
+func testEnv() ffmpegEnv {
+	return ffmpegEnv{
+		Input:           "/uploads/job_input.mp4",
+		NormalizedInput: "/uploads/job_normalized.mkv",
+		Output:          "/static/job_compressed.mp4",
+		GPUAvailable:    true,
+	}
+}
+
+func TestBuildFFmpegArgsKeepsTenBitSourcePrecision(t *testing.T) {
+	opts := CompressionOptions{Codec: "hevc_nvenc", BitDepth: highBitDepth}
+
+	plan, err := buildFFmpegArgs(opts, tenBitSource(), testEnv())
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+
+	if plan.Normalize != nil {
+		filter := plan.Normalize[slices.Index(plan.Normalize, "-vf")+1]
+		if !strings.HasSuffix(filter, "format=yuv420p10le") {
+			t.Errorf("normalization filter %q truncates the source to 8 bits", filter)
+		}
+	}
+
+	args, _ := buildEncodeArgs(plan.Params)
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-pix_fmt p010le -profile:v main10") {
+		t.Errorf("encode args %q do not select 10-bit main10", joined)
+	}
+	if strings.Contains(joined, "-pix_fmt yuv420p ") {
+		t.Errorf("encode args %q force 8-bit output", joined)
+	}
+}
+
+func TestBuildFFmpegArgsHLSNeedsFrameRateForKeyframes(t *testing.T) {
+	source := tenBitSource()
+	source.FrameRate = ""
+
+	if _, err := buildFFmpegArgs(CompressionOptions{Codec: "h264_nvenc", Mode: modeHLS}, source, testEnv()); err == nil {
+		t.Error("buildFFmpegArgs accepted an HLS job whose keyframes cannot be aligned with the segments")
+	}
+}
+
+func TestBuildHLSArgsMapsSelectedVideoStream(t *testing.T) {
+	args := buildHLSArgs(encodeParams{
+		Input:       "/uploads/job_input.mp4",
+		Encoder:     "h264_nvenc",
+		VideoStream: 1,
+		Renditions:  []HLSRendition{{Height: 720, Bitrate: "3M"}},
+	})
+
+	graph := args[slices.Index(args, "-filter_complex")+1]
+	if !strings.HasPrefix(graph, "[0:v:1]") {
+		t.Errorf("filter graph %q does not start from the selected video stream", graph)
+	}
+}
+
+func TestAutoBitrateUsesFallbackEncoderEfficiency(t *testing.T) {
+	env := testEnv()
+	env.GPUAvailable = false
+	source := &VideoMetrics{Width: 1920, Height: 1080, Duration: 10, VideoCodec: "h264", FrameRate: "30", PixelFormat: "yuv420p"}
+	opts := CompressionOptions{Codec: "av1_nvenc", Container: "webm", Bitrate: bitrateAuto, QualityTier: defaultQualityTier}
+
+	plan, err := buildFFmpegArgs(opts, source, env)
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+	if !strings.Contains(plan.BitrateHeuristic, "x 0.55 for libsvtav1") {
+		t.Errorf("bitrate heuristic %q does not use the AV1 factor of the CPU fallback", plan.BitrateHeuristic)
+	}
+}
+
+func TestBuildFFmpegArgsReportsMaxHeightSeparately(t *testing.T) {
+	source := &VideoMetrics{Width: 3840, Height: 2160, Duration: 10, VideoCodec: "h264", FrameRate: "30", PixelFormat: "yuv420p"}
+
+	plan, err := buildFFmpegArgs(CompressionOptions{Codec: "h264_nvenc", MaxHeight: 1080}, source, testEnv())
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+	if plan.TargetHeight != 1080 {
+		t.Errorf("target height = %d, want 1080", plan.TargetHeight)
+	}
+	if plan.Decision != "" {
+		t.Errorf("resolution decision = %q, want none for a maxHeight clamp", plan.Decision)
+	}
+	if want := "downscaled from 2160p to the 1080p maxHeight"; plan.MaxHeightDecision != want {
+		t.Errorf("maxHeight decision = %q, want %q", plan.MaxHeightDecision, want)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const defaultConfigFile = "./config.json"
+
+type LadderRung struct {
+	MaxHeight int    `json:"maxHeight"`
+	Bitrate   string `json:"bitrate"`
+}
+
+type Settings struct {
+	VideoCodec            string       `json:"videoCodec"`
+	Preset                string       `json:"preset"`
+	VideoBitrate          string       `json:"videoBitrate"`
+	BitrateLadder         []LadderRung `json:"bitrateLadder,omitempty"`
+	AudioCodec            string       `json:"audioCodec"`
+	AudioBitrate          string       `json:"audioBitrate"`
+	UpscalePolicy         string       `json:"upscalePolicy"`
+	CPUThreads            int          `json:"cpuThreads"`
+	CPUNiceness           int          `json:"cpuNiceness"`
+	NormalizeInputs       bool         `json:"normalizeInputs"`
+	CompatiblePixelFormat bool         `json:"compatiblePixelFormat"`
+	EncodeRetries         int          `json:"encodeRetries"`
+	RetryableErrors       []string     `json:"retryableErrors"`
+	PreserveFilenames     bool         `json:"preserveFilenames"`
+}
+
+var settings = defaultSettings()
+
+var bitratePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+var videoCodecPresets = map[string][]string{
+	"h264_nvenc": nvencPresets,
+	"hevc_nvenc": nvencPresets,
+	"av1_nvenc":  nvencPresets,
+	"libx264":    x26xPresets,
+	"libx265":    x26xPresets,
+	"libsvtav1":  svtAV1Presets,
+}
+
+var nvencPresets = []string{
+	"default", "slow", "medium", "fast", "hp", "hq", "bd", "ll", "llhq", "llhp", "lossless", "losslesshp",
+	"p1", "p2", "p3", "p4", "p5", "p6", "p7",
+}
+
+var x26xPresets = []string{
+	"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo",
+}
+
+// SVT-AV1 numbers its presets from 0 (slowest) to 13 (fastest).
+var svtAV1Presets = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"}
+
+const svtAV1DefaultPreset = "8"
+
+var audioCodecs = []string{"aac", "libopus", "copy"}
+
+func defaultSettings() Settings {
+	return Settings{
+		VideoCodec:            "h264_nvenc",
+		Preset:                "fast",
+		VideoBitrate:          "2M",
+		AudioCodec:            "aac",
+		AudioBitrate:          "128k",
+		UpscalePolicy:         upscalePolicyClamp,
+		CPUNiceness:           10,
+		NormalizeInputs:       true,
+		CompatiblePixelFormat: true,
+		EncodeRetries:         2,
+		RetryableErrors:       defaultRetryableErrors,
+		PreserveFilenames:     true,
+	}
+}
+
+func loadSettings(path string) (Settings, error) {
+	loaded := defaultSettings()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return loaded, nil
+	}
+	if err != nil {
+		return loaded, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&loaded); err != nil {
+		return loaded, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return loaded, nil
+}
+
+func (s *Settings) validate() error {
+	presets, ok := videoCodecPresets[s.VideoCodec]
+	if !ok {
+		return fmt.Errorf("unsupported videoCodec %q", s.VideoCodec)
+	}
+
+	if !slices.Contains(presets, s.Preset) {
+		return fmt.Errorf("preset %q is not valid for %s", s.Preset, s.VideoCodec)
+	}
+
+	if !bitratePattern.MatchString(s.VideoBitrate) {
+		return fmt.Errorf("invalid videoBitrate %q", s.VideoBitrate)
+	}
+
+	for _, rung := range s.BitrateLadder {
+		if rung.MaxHeight <= 0 {
+			return fmt.Errorf("bitrateLadder maxHeight must be positive, got %d", rung.MaxHeight)
+		}
+		if !bitratePattern.MatchString(rung.Bitrate) {
+			return fmt.Errorf("invalid bitrateLadder bitrate %q", rung.Bitrate)
+		}
+	}
+	sort.Slice(s.BitrateLadder, func(i, j int) bool {
+		return s.BitrateLadder[i].MaxHeight < s.BitrateLadder[j].MaxHeight
+	})
+
+	if !slices.Contains(audioCodecs, s.AudioCodec) {
+		return fmt.Errorf("unsupported audioCodec %q", s.AudioCodec)
+	}
+
+	if s.AudioCodec != "copy" && !bitratePattern.MatchString(s.AudioBitrate) {
+		return fmt.Errorf("invalid audioBitrate %q", s.AudioBitrate)
+	}
+
+	switch s.UpscalePolicy {
+	case upscalePolicyWarn, upscalePolicyReject, upscalePolicyClamp:
+	default:
+		return fmt.Errorf("invalid upscalePolicy %q: must be warn, reject or clamp", s.UpscalePolicy)
+	}
+
+	if s.CPUThreads < 0 || s.CPUThreads > runtime.NumCPU() {
+		return fmt.Errorf("cpuThreads must be between 0 and %d, got %d", runtime.NumCPU(), s.CPUThreads)
+	}
+
+	if s.CPUNiceness < 0 || s.CPUNiceness > 19 {
+		return fmt.Errorf("cpuNiceness must be between 0 and 19, got %d", s.CPUNiceness)
+	}
+
+	if s.EncodeRetries < 0 || s.EncodeRetries > 5 {
+		return fmt.Errorf("encodeRetries must be between 0 and 5, got %d", s.EncodeRetries)
+	}
+
+	if slices.Contains(s.RetryableErrors, "") {
+		return fmt.Errorf("retryableErrors must not contain an empty string")
+	}
+
+	return nil
+}
+
+func (s *Settings) cpuThreadsFor(requested int) int {
+	if requested > 0 {
+		return requested
+	}
+	if s.CPUThreads > 0 {
+		return s.CPUThreads
+	}
+	return max(1, runtime.NumCPU()/2)
+}
+
+func (s *Settings) presetFor(codec, requested string) string {
+	if requested != "" && slices.Contains(videoCodecPresets[codec], requested) {
+		return requested
+	}
+	if slices.Contains(videoCodecPresets[codec], s.Preset) {
+		return s.Preset
+	}
+	if codec == "libsvtav1" {
+		return svtAV1DefaultPreset
+	}
+	return "fast"
+}
+
+func (s *Settings) videoBitrateFor(height int) string {
+	for _, rung := range s.BitrateLadder {
+		if height <= rung.MaxHeight {
+			return rung.Bitrate
+		}
+	}
+	return s.VideoBitrate
+}
+
+func isNVENC(codec string) bool {
+	return strings.HasSuffix(codec, "_nvenc")
+}
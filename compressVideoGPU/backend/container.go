@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+const defaultContainer = "mp4"
+
+var containerMuxers = map[string]string{
+	"mp4":  "mp4",
+	"webm": "webm",
+	"mkv":  "matroska",
+}
+
+var webmVideoEncoders = []string{"av1_nvenc", "libsvtav1"}
+
+func (o CompressionOptions) container() string {
+	if o.Container == "" {
+		return defaultContainer
+	}
+	return o.Container
+}
+
+func outputFilename(jobID string, opts CompressionOptions) string {
+	if opts.animated() {
+		return fmt.Sprintf("%s_output.%s", jobID, opts.OutputType)
+	}
+	if opts.audioOnly() {
+		return fmt.Sprintf("%s_output.%s", jobID, opts.AudioFormat)
+	}
+	if opts.hls() {
+		return jobID + "/" + hlsMasterPlaylist
+	}
+	return fmt.Sprintf("%s_output.%s", jobID, opts.container())
+}
+
+func validateContainerName(container string, fragmented bool) error {
+	if _, ok := containerMuxers[container]; !ok {
+		return fmt.Errorf("unsupported container %q: must be mp4, webm or mkv", container)
+	}
+	if fragmented && container != "mp4" {
+		return fmt.Errorf("fragmented output is only available for mp4")
+	}
+	return nil
+}
+
+func validateContainer(container, encoder string, fragmented bool) error {
+	if err := validateContainerName(container, fragmented); err != nil {
+		return err
+	}
+	if container == "webm" && !slices.Contains(webmVideoEncoders, encoder) {
+		return fmt.Errorf("webm requires AV1 video, %s cannot be muxed into it", encoder)
+	}
+	return nil
+}
+
+// validateAudioCodec checks a per-job audio codec against the container. The
+// copied source audio could be anything, so webm only takes Opus.
+func validateAudioCodec(container, codec string) error {
+	if container == "webm" && codec != "" && codec != "libopus" {
+		return fmt.Errorf("webm only accepts Opus or Vorbis audio, use libopus instead of %s", codec)
+	}
+	return nil
+}
+
+func containerAudioCodec(container string) string {
+	if container == "webm" && settings.AudioCodec != "libopus" {
+		return "libopus"
+	}
+	return settings.AudioCodec
+}
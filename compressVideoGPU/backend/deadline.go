@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	deadlineCheckInterval  = time.Second
+	deadlineMinProgressPct = 2
+)
+
+func deadlinePresets(codec string) (quality, fast string) {
+	if isNVENC(codec) {
+		return "p6", "p1"
+	}
+	if codec == "libsvtav1" {
+		return "4", "12"
+	}
+	return "slow", "ultrafast"
+}
+
+func encodeWithinDeadline(ctx context.Context, jobID, codec string, args []string, presetIndex int, duration float64, niceness int, start, deadline time.Time) ([]byte, bool, error) {
+	quality, fast := deadlinePresets(codec)
+	args[presetIndex] = quality
+
+	attemptCtx, cancel := context.WithCancel(ctx)
+	var missed atomic.Bool
+	go watchDeadline(attemptCtx, cancel, jobID, time.Now(), deadline, &missed)
+
+	output, err := runFFmpegWithProgress(attemptCtx, jobID, args, duration, niceness)
+	cancel()
+	if !missed.Load() {
+		return output, false, err
+	}
+
+	jobLogger(jobID).Warn("Job is projected to miss its deadline, switching preset", "event", "deadline_downgrade",
+		"preset", quality, "fallbackPreset", fast, "durationMs", time.Since(start).Milliseconds())
+
+	args[presetIndex] = fast
+	setJobPhaseProgress(jobID, 0)
+	output, err = runFFmpegWithProgress(ctx, jobID, args, duration, niceness)
+	return output, true, err
+}
+
+func watchDeadline(ctx context.Context, cancel context.CancelFunc, jobID string, encodeStart, deadline time.Time, missed *atomic.Bool) {
+	ticker := time.NewTicker(deadlineCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		progress := getJobProgress(jobID)
+		if progress == nil || progress.PhaseProgress < deadlineMinProgressPct {
+			if time.Now().After(deadline) {
+				missed.Store(true)
+				cancel()
+				return
+			}
+			continue
+		}
+
+		elapsed := time.Since(encodeStart)
+		projected := encodeStart.Add(elapsed * 100 / time.Duration(progress.PhaseProgress))
+		if projected.After(deadline) {
+			missed.Store(true)
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+// inputHashes maps an input's SHA-256 plus the options it was compressed with
+// to the completed job that produced the output. Guarded by jobMutex.
+var inputHashes = make(map[string]string)
+
+func dedupeKey(inputHash string, opts CompressionOptions) string {
+	// Priority only decides when a job runs, and the label and callback only
+	// concern the client that submitted it, not what it produces.
+	opts.Priority = ""
+	opts.Label = ""
+	opts.CallbackURL = ""
+	encoded, _ := json.Marshal(opts)
+	sum := sha256.Sum256(encoded)
+	return inputHash + ":" + hex.EncodeToString(sum[:])
+}
+
+func indexJobHashLocked(job *Job) {
+	if job.InputHash != "" && job.Status == "complete" {
+		inputHashes[dedupeKey(job.InputHash, job.Options)] = job.ID
+	}
+}
+
+func unindexJobHashLocked(job *Job) {
+	if job.InputHash == "" {
+		return
+	}
+	key := dedupeKey(job.InputHash, job.Options)
+	if inputHashes[key] == job.ID {
+		delete(inputHashes, key)
+	}
+}
+
+func findDuplicateJob(inputHash string, opts CompressionOptions) string {
+	jobMutex.RLock()
+	jobID := inputHashes[dedupeKey(inputHash, opts)]
+	job, ok := jobsByID[jobID]
+	ok = ok && job.Status == "complete"
+	jobMutex.RUnlock()
+	if !ok {
+		return ""
+	}
+
+	// Outputs in a bucket are only deleted together with their job.
+	if _, local := outputs.(localStore); !local {
+		return jobID
+	}
+	if _, err := os.Stat(filepath.Join(staticDir, outputFilename(jobID, opts))); err != nil {
+		return ""
+	}
+	return jobID
+}
+
+// hashFile returns the SHA-256 of a file that was assembled on disk, such as a
+// chunked upload, for inputs that could not be hashed while they arrived.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func saveHashedUpload(file *multipart.FileHeader, dst string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hasher), src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
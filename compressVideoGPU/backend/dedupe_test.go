@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupeKeyIgnoresPerClientOptions(t *testing.T) {
+	base := CompressionOptions{Codec: "h264_nvenc", Preset: "p4"}
+	key := dedupeKey("abc", base)
+
+	client := base
+	client.Label = "nightly"
+	client.CallbackURL = "https://example.com/hook"
+	client.Priority = "high"
+	if got := dedupeKey("abc", client); got != key {
+		t.Errorf("dedupeKey with label, callback and priority = %q, want %q", got, key)
+	}
+
+	other := base
+	other.Codec = "hevc_nvenc"
+	if dedupeKey("abc", other) == key {
+		t.Error("dedupeKey ignores the codec")
+	}
+}
+
+func TestDeduplicatedResponseCarriesCallerOptions(t *testing.T) {
+	previousUpload, previousStatic := uploadDir, staticDir
+	uploadDir, staticDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { uploadDir, staticDir = previousUpload, previousStatic })
+
+	original := CompressionOptions{Codec: "h264_nvenc", Label: "theirs", CallbackURL: "https://example.com/hook?token=secret"}
+	addJob(&Job{ID: "original", Status: "complete", Created: time.Now(), Options: original, InputHash: "abc"})
+	t.Cleanup(func() { deleteJob("original") })
+	jobMutex.Lock()
+	indexJobHashLocked(jobsByID["original"])
+	jobMutex.Unlock()
+	if err := os.WriteFile(filepath.Join(staticDir, outputFilename("original", original)), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	inputPath := filepath.Join(uploadDir, "duplicate_input.mp4")
+	if err := os.WriteFile(inputPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	caller := CompressionOptions{Codec: "h264_nvenc", Label: "mine"}
+	_, response := submitUploadedJob("duplicate", inputPath, "video.mp4", 0, caller, "", "abc")
+
+	if response["deduplicated"] != true {
+		t.Fatalf("response = %+v, want a deduplicated job", response)
+	}
+	if opts, _ := response["options"].(CompressionOptions); opts.Label != "mine" || opts.CallbackURL != "" {
+		t.Errorf("response options = %+v, want the caller's own options", response["options"])
+	}
+	if _, err := os.Stat(inputPath); !os.IsNotExist(err) {
+		t.Errorf("duplicate input was kept: %v", err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.mp4")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got, err := hashFile(path); err != nil || got != want {
+		t.Errorf("hashFile() = %q, %v, want %q", got, err, want)
+	}
+}
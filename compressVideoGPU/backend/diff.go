@@ -0,0 +1,22 @@
+package main
+
+// MetricsDiff compares the compressed output with the original, so clients
+// don't each derive it from the two sides of ComparisonMetrics. Reductions
+// are positive when the output is smaller.
+type MetricsDiff struct {
+	SizeReduction     int64   `json:"sizeReduction"`
+	BitrateReduction  int64   `json:"bitrateReduction"`
+	ResolutionChanged bool    `json:"resolutionChanged"`
+	CodecChanged      bool    `json:"codecChanged"`
+	DurationDelta     float64 `json:"durationDelta"`
+}
+
+func metricsDiff(original, compressed VideoMetrics) *MetricsDiff {
+	return &MetricsDiff{
+		SizeReduction:     original.Size - compressed.Size,
+		BitrateReduction:  original.Bitrate - compressed.Bitrate,
+		ResolutionChanged: original.Width != compressed.Width || original.Height != compressed.Height,
+		CodecChanged:      original.VideoCodec != compressed.VideoCodec,
+		DurationDelta:     compressed.Duration - original.Duration,
+	}
+}
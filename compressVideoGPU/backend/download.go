@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDownloadNameLength = 200
+
+func getJobFilename(jobID string) string {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Filename
+	}
+	return ""
+}
+
+// sanitizeFilename keeps the last path element of a client-supplied name and
+// drops control characters, quotes and backslashes, so the result can't
+// escape the Content-Disposition header or the quoted string inside it.
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '\\' || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	if runes := []rune(name); len(runes) > maxDownloadNameLength {
+		name = string(runes[:maxDownloadNameLength])
+	}
+	return name
+}
+
+// downloadFilename is the original upload name with the extension of the
+// output, e.g. holiday.mov compressed to mp4 downloads as holiday.mp4.
+func downloadFilename(original, output string) string {
+	name := sanitizeFilename(original)
+	stem := strings.TrimSpace(strings.TrimSuffix(name, filepath.Ext(name)))
+	if stem == "" {
+		return ""
+	}
+	return stem + filepath.Ext(output)
+}
+
+// contentDisposition offers an ASCII fallback in filename and the exact name
+// in the RFC 5987 filename* parameter for clients that understand it.
+func contentDisposition(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	value := `attachment; filename="` + fallback + `"`
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + awsEscape(filename)
+	}
+	return value
+}
+
+// outputJobID returns the job whose compressed output the static name is.
+func outputJobID(name string) (string, bool) {
+	jobID, _, ok := strings.Cut(name, "_output.")
+	if !ok || strings.Contains(jobID, "/") {
+		return "", false
+	}
+	status := getJobStatus(jobID)
+	return jobID, status != "" && outputFilename(jobID, getJobOptions(jobID)) == name
+}
+
+// handleStaticDownload serves staticDir like router.Static with byte range
+// support, and names the compressed output of a job after the file that was
+// uploaded.
+func handleStaticDownload(c *gin.Context) {
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+	filePath := filepath.Join(staticDir, filepath.FromSlash(name))
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+
+	if jobID, ok := outputJobID(name); ok && settings.PreserveFilenames {
+		if filename := downloadFilename(getJobFilename(jobID), name); filename != "" {
+			c.Header("Content-Disposition", contentDisposition(filename))
+		}
+	}
+	serveFileRange(c, filePath)
+}
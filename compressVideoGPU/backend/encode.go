@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nvencUnavailableMarkers mean the driver or the device is missing. NVENC
+// is marked unavailable until the next probe.
+var nvencUnavailableMarkers = []string{
+	"Cannot load nvcuda",
+	"Cannot load libcuda",
+	"Cannot load libnvidia-encode",
+	"No NVENC capable devices found",
+	"No capable devices found",
+}
+
+// nvencBusyMarkers are errors of a working GPU that has run out of encode
+// sessions or memory. The encode is retried on the GPU, and only the job
+// moves to the CPU if they persist.
+var nvencBusyMarkers = []string{
+	"OpenEncodeSessionEx failed",
+	"CUDA_ERROR_OUT_OF_MEMORY",
+}
+
+type encodeParams struct {
+	Input         string
+	Output        string
+	Encoder       string
+	GPUScaling    bool
+	TargetHeight  int
+	Bitrate       string
+	Maxrate       string
+	Bufsize       string
+	CRF           *int
+	ExtraFilters  []string
+	AudioLayout   []AudioTrack
+	Streams       []int
+	VideoStream   int
+	Lossless      bool
+	SourcePixFmt  string
+	Threads       int
+	Fragmented    bool
+	Container     string
+	TwoPass       bool
+	AudioMode     string
+	AudioBitrate  string
+	AudioCodec    string
+	Preset        string
+	ToneMap       bool
+	Overlay       string
+	OverlayPos    string
+	Trim          []string
+	OutputType    string
+	AudioFormat   string
+	TargetFPS     float64
+	GPU           *int
+	Remux         bool
+	StripMetadata bool
+	FPS           int
+	Width         int
+	Pass          int
+	PassLog       string
+	SubtitleCopy  *int
+	SubtitleCodec string
+	BurnSubtitles bool
+	PixelFormat   string
+	BitDepth      int
+	GOP           int
+	GOPSeconds    float64
+	Renditions    []HLSRendition
+	Denoise       string
+	Sharpen       string
+	Rotated       bool
+	AudioFilter   string
+}
+
+func encodeGPU(p encodeParams) *int {
+	if !isNVENC(p.Encoder) {
+		return nil
+	}
+	return p.GPU
+}
+
+func buildEncodeArgs(p encodeParams) ([]string, int) {
+	if p.OutputType == outputTypeAudio {
+		return buildAudioArgs(p), -1
+	}
+	if p.OutputType != "" {
+		return buildAnimatedArgs(p), -1
+	}
+	if p.Remux {
+		return buildRemuxArgs(p), -1
+	}
+	if len(p.Renditions) > 0 {
+		return buildHLSArgs(p), -1
+	}
+
+	args := []string{"-y"}
+	if p.GPUScaling {
+		args = append(args, "-hwaccel", "cuda", "-hwaccel_output_format", "cuda")
+		if p.GPU != nil {
+			args = append(args, "-hwaccel_device", strconv.Itoa(*p.GPU))
+		}
+	}
+	args = append(args, p.Trim...)
+	if p.Rotated {
+		args = append(args, rotationInputArgs()...)
+	}
+	args = append(args, "-i", p.Input)
+	if p.Overlay != "" {
+		args = append(args, "-i", p.Overlay)
+	}
+
+	var filters []string
+	if p.ToneMap {
+		filters = append(filters, toneMapFilter)
+	}
+	if p.TargetFPS > 0 {
+		filters = append(filters, "fps="+strconv.FormatFloat(p.TargetFPS, 'f', -1, 64))
+	}
+	var scale []string
+	if p.GPUScaling {
+		scale = append(scale, fmt.Sprintf("scale_cuda=-2:%d", p.TargetHeight))
+	} else if p.TargetHeight > 0 {
+		scale = append(scale, fmt.Sprintf("scale=-2:%d", p.TargetHeight))
+	}
+	filters = append(filters, withEnhancement(scale, p.Denoise, p.Sharpen)...)
+	filters = append(filters, p.ExtraFilters...)
+
+	videoMap := fmt.Sprintf("0:v:%d", p.VideoStream)
+	if p.Overlay != "" {
+		label := ""
+		if len(p.AudioLayout) > 0 || len(p.Streams) > 0 || p.SubtitleCopy != nil {
+			label = "v"
+		}
+		args = append(args, "-filter_complex", overlayGraph(filters, videoMap, p.OverlayPos, label))
+		if label != "" {
+			videoMap = "[v]"
+		}
+	} else if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+
+	if len(p.AudioLayout) > 0 || len(p.Streams) > 0 {
+		args = append(args, audioTrackArgs(p.AudioLayout, videoMap)...)
+	} else if p.SubtitleCopy != nil {
+		args = append(args, "-map", videoMap, "-map", "0:a:0?")
+	}
+	if p.SubtitleCopy != nil {
+		args = append(args, "-map", fmt.Sprintf("0:s:%d", *p.SubtitleCopy), "-c:s", p.SubtitleCodec)
+	} else if p.BurnSubtitles {
+		args = append(args, "-sn")
+	}
+	args = append(args, "-c:v", p.Encoder)
+	if p.GPU != nil && isNVENC(p.Encoder) {
+		args = append(args, "-gpu", strconv.Itoa(*p.GPU))
+	}
+
+	presetIndex := -1
+	if p.Lossless {
+		pixFmt := "yuv444p"
+		if p.SourcePixFmt == "yuv420p" {
+			pixFmt = "yuv420p"
+		}
+		switch {
+		case isNVENC(p.Encoder):
+			args = append(args, "-preset", "p7", "-tune", "lossless")
+		case p.Encoder == "libx265":
+			args = append(args, "-preset", "medium", "-x265-params", "lossless=1")
+		case p.Encoder == "libsvtav1":
+			args = append(args, "-preset", svtAV1DefaultPreset, "-svtav1-params", "lossless=1")
+		default:
+			args = append(args, "-preset", "medium", "-qp", "0")
+		}
+		args = append(args, "-pix_fmt", pixFmt)
+	} else {
+		presetIndex = len(args) + 1
+		args = append(args, "-preset", settings.presetFor(p.Encoder, p.Preset))
+		switch {
+		case p.CRF != nil && isNVENC(p.Encoder):
+			args = append(args, "-rc", "vbr", "-cq", strconv.Itoa(*p.CRF), "-b:v", "0")
+		case p.CRF != nil:
+			args = append(args, "-crf", strconv.Itoa(*p.CRF))
+		default:
+			args = append(args, "-b:v", p.Bitrate)
+			args = append(args, rateCapArgs(p.Maxrate, p.Bufsize)...)
+		}
+		if p.BitDepth == highBitDepth {
+			args = append(args, tenBitArgs(p.Encoder)...)
+		} else if p.PixelFormat != "" {
+			args = append(args, "-pix_fmt", p.PixelFormat)
+		}
+
+		if p.TwoPass {
+			switch {
+			case isNVENC(p.Encoder):
+				args = append(args, "-multipass", "fullres")
+			case p.Encoder == "libx265":
+				args = append(args, "-x265-params", fmt.Sprintf("pass=%d:stats=%s", p.Pass, p.PassLog))
+			default:
+				args = append(args, "-pass", strconv.Itoa(p.Pass), "-passlogfile", p.PassLog)
+			}
+		}
+	}
+
+	if p.GOP > 0 {
+		args = append(args, keyframeArgs(p.Encoder, p.GOP, p.GOPSeconds)...)
+	}
+	if p.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(p.Threads))
+	}
+	if p.ToneMap {
+		args = append(args, "-color_primaries", "bt709", "-color_trc", "bt709", "-colorspace", "bt709")
+	}
+	if p.Rotated {
+		args = append(args, rotationOutputArgs()...)
+	}
+
+	if p.Pass == 1 {
+		return append(args, "-an", "-f", "null", os.DevNull), presetIndex
+	}
+
+	switch p.AudioMode {
+	case audioModeStrip:
+		args = append(args, "-an")
+	case audioModeCopy:
+		args = append(args, "-c:a", "copy")
+	default:
+		audioCodec := containerAudioCodec(p.Container)
+		if p.AudioCodec != "" {
+			audioCodec = p.AudioCodec
+		}
+		if p.AudioMode == audioModeReencode && audioCodec == "copy" {
+			audioCodec = "aac"
+		}
+		audioBitrate := p.AudioBitrate
+		if audioBitrate == "" {
+			audioBitrate = settings.AudioBitrate
+		}
+
+		if p.AudioFilter != "" && audioCodec == "copy" {
+			audioCodec = "aac"
+		}
+
+		args = append(args, "-c:a", audioCodec)
+		if audioCodec != "copy" && audioBitrate != "" {
+			args = append(args, "-b:a", audioBitrate)
+		}
+		if p.AudioFilter != "" {
+			args = append(args, "-af", p.AudioFilter, "-ar", loudnessSampleRate)
+		}
+	}
+	if p.Fragmented {
+		args = append(args, "-movflags", "frag_keyframe+empty_moov+default_base_moof")
+	}
+	if muxer, ok := containerMuxers[p.Container]; ok {
+		args = append(args, "-f", muxer)
+	}
+	return append(args, p.Output), presetIndex
+}
+
+func runEncode(ctx context.Context, jobID string, p encodeParams, duration float64, start, deadline time.Time) ([]byte, bool, error) {
+	args, presetIndex := buildEncodeArgs(p)
+
+	niceness := 0
+	if !isNVENC(p.Encoder) {
+		niceness = settings.CPUNiceness
+	}
+
+	if p.TwoPass && !isNVENC(p.Encoder) {
+		output, err := runTwoPassEncode(ctx, jobID, p, duration, niceness)
+		return output, false, err
+	}
+
+	if !deadline.IsZero() && presetIndex >= 0 {
+		return encodeWithinDeadline(ctx, jobID, p.Encoder, args, presetIndex, duration, niceness, start, deadline)
+	}
+
+	output, err := runFFmpegWithProgress(ctx, jobID, args, duration, niceness)
+	return output, false, err
+}
+
+// cpuFallbackEncoder picks the software encoder for the same codec, so the
+// output still fits its container: webm only takes AV1.
+func cpuFallbackEncoder(codec string) string {
+	switch codec {
+	case "hevc_nvenc":
+		return "libx265"
+	case "av1_nvenc":
+		return "libsvtav1"
+	}
+	return "libx264"
+}
+
+// supportsTwoPass reports whether ffmpeg can run a two-pass encode with the
+// encoder; the libsvtav1 wrapper ignores -pass and has no stats file.
+func supportsTwoPass(encoder string) bool {
+	return encoder != "libsvtav1"
+}
+
+func nvencUnavailable(output []byte) bool {
+	for _, marker := range nvencUnavailableMarkers {
+		if strings.Contains(string(output), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func nvencBusy(output []byte) bool {
+	for _, marker := range nvencBusyMarkers {
+		if strings.Contains(string(output), marker) {
+			return true
+		}
+	}
+	return false
+}
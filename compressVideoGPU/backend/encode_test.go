@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCPUFallbackKeepsWebMMuxable(t *testing.T) {
+	source := &VideoMetrics{Width: 1920, Height: 1080, Duration: 10, VideoCodec: "h264", FrameRate: "30", PixelFormat: "yuv420p"}
+	env := testEnv()
+	env.GPUAvailable = false
+
+	plan, err := buildFFmpegArgs(CompressionOptions{Codec: "av1_nvenc", Container: "webm", TwoPass: true}, source, env)
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+	if plan.Params.Encoder != "libsvtav1" || !plan.CPUFallback {
+		t.Fatalf("encoder = %q (fallback %v), want libsvtav1", plan.Params.Encoder, plan.CPUFallback)
+	}
+	if plan.Params.TwoPass {
+		t.Error("libsvtav1 fallback kept a two-pass encode")
+	}
+
+	args, _ := buildEncodeArgs(plan.Params)
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-c:v libsvtav1", "-preset " + svtAV1DefaultPreset, "-f webm"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("encode args %q do not contain %q", joined, want)
+		}
+	}
+}
+
+func TestCPUFallbackEncoder(t *testing.T) {
+	for codec, want := range map[string]string{
+		"h264_nvenc": "libx264",
+		"hevc_nvenc": "libx265",
+		"av1_nvenc":  "libsvtav1",
+	} {
+		if got := cpuFallbackEncoder(codec); got != want {
+			t.Errorf("cpuFallbackEncoder(%q) = %q, want %q", codec, got, want)
+		}
+	}
+}
+
+func TestNVENCErrorClassification(t *testing.T) {
+	tests := []struct {
+		output      string
+		unavailable bool
+		busy        bool
+	}{
+		{"[h264_nvenc @ 0x5] OpenEncodeSessionEx failed: out of memory (10): (no details)", false, true},
+		{"[hevc_nvenc @ 0x5] OpenEncodeSessionEx failed: incompatible client key (21): (no details)", false, true},
+		{"[h264_nvenc @ 0x5] Cannot load libnvidia-encode.so.1", true, false},
+		{"[h264_nvenc @ 0x5] No capable devices found", true, false},
+		{"Invalid data found when processing input", false, false},
+	}
+	for _, tt := range tests {
+		output := []byte(tt.output)
+		if got := nvencUnavailable(output); got != tt.unavailable {
+			t.Errorf("nvencUnavailable(%q) = %v, want %v", tt.output, got, tt.unavailable)
+		}
+		if got := nvencBusy(output); got != tt.busy {
+			t.Errorf("nvencBusy(%q) = %v, want %v", tt.output, got, tt.busy)
+		}
+		if got := retryableEncode("h264_nvenc", output); got != tt.busy {
+			t.Errorf("retryableEncode(%q) = %v, want %v", tt.output, got, tt.busy)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	denoiseHQDN3D  = "hqdn3d"
+	denoiseNLMeans = "nlmeans"
+
+	// Strengths are in each filter's own unit: the hqdn3d luma spatial
+	// strength (ffmpeg derives the chroma and temporal ones from it), the
+	// nlmeans denoising strength s and the unsharp luma amount.
+	defaultHQDN3DStrength  = 4.0
+	maxHQDN3DStrength      = 20.0
+	defaultNLMeansStrength = 3.0
+	maxNLMeansStrength     = 30.0
+	defaultSharpenStrength = 0.8
+	maxSharpenStrength     = 2.0
+)
+
+func defaultDenoiseStrength(filter string) float64 {
+	if filter == denoiseNLMeans {
+		return defaultNLMeansStrength
+	}
+	return defaultHQDN3DStrength
+}
+
+func validateDenoiseStrength(filter string, strength float64) error {
+	limit := maxHQDN3DStrength
+	if filter == denoiseNLMeans {
+		limit = maxNLMeansStrength
+	}
+	if strength <= 0 || strength > limit {
+		return fmt.Errorf("%s strength must be between 0 and %g", filter, limit)
+	}
+	return nil
+}
+
+func (o CompressionOptions) denoiseFilter() string {
+	strength := strconv.FormatFloat(o.DenoiseStrength, 'f', -1, 64)
+	switch o.Denoise {
+	case denoiseHQDN3D:
+		return "hqdn3d=" + strength
+	case denoiseNLMeans:
+		return "nlmeans=s=" + strength
+	}
+	return ""
+}
+
+// sharpenFilter sharpens luma only with a 5x5 unsharp mask; sharpening chroma
+// mostly brings out color noise.
+func (o CompressionOptions) sharpenFilter() string {
+	if !o.Sharpen {
+		return ""
+	}
+	return fmt.Sprintf("unsharp=5:5:%s:5:5:0", strconv.FormatFloat(o.SharpenStrength, 'f', -1, 64))
+}
+
+// withEnhancement places the denoise and sharpen filters around the scaling
+// step: noise is removed at the source resolution, before scaling smears it
+// into neighbouring pixels, and sharpening runs at the output resolution so
+// the downscale doesn't soften it again.
+func withEnhancement(scale []string, denoise, sharpen string) []string {
+	var filters []string
+	if denoise != "" {
+		filters = append(filters, denoise)
+	}
+	filters = append(filters, scale...)
+	if sharpen != "" {
+		filters = append(filters, sharpen)
+	}
+	return filters
+}
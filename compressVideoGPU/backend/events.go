@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const eventKeepAliveInterval = 15 * time.Second
+
+type JobEvent struct {
+	JobID         string `json:"jobID"`
+	Status        string `json:"status"`
+	Phase         string `json:"phase,omitempty"`
+	Progress      int    `json:"progress"`
+	QueuePosition int    `json:"queuePosition,omitempty"`
+}
+
+var jobSubscribers = make(map[string][]chan JobEvent)
+
+func isTerminalStatus(status string) bool {
+	return status == "complete" || status == "failed" || status == "cancelled"
+}
+
+// jobEventLocked and notifyJobLocked must be called with jobMutex held.
+func jobEventLocked(jobID string) JobEvent {
+	event := JobEvent{
+		JobID:         jobID,
+		QueuePosition: queuePositionLocked(jobID),
+	}
+	if job, ok := jobsByID[jobID]; ok {
+		event.Status = job.Status
+		if job.Progress != nil {
+			event.Phase = job.Progress.Phase
+			event.Progress = job.Progress.Overall
+		} else if job.Upload != nil && job.Status == "uploading" {
+			event.Progress = job.Upload.percent()
+		}
+	}
+	if event.Status == "complete" {
+		event.Progress = 100
+	}
+	return event
+}
+
+func notifyJobLocked(jobID string) {
+	subscribers := jobSubscribers[jobID]
+	if len(subscribers) == 0 {
+		return
+	}
+
+	event := jobEventLocked(jobID)
+	for _, ch := range subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
+
+func subscribeJob(jobID string) (chan JobEvent, JobEvent) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	ch := make(chan JobEvent, 1)
+	jobSubscribers[jobID] = append(jobSubscribers[jobID], ch)
+	return ch, jobEventLocked(jobID)
+}
+
+func unsubscribeJob(jobID string, ch chan JobEvent) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	subscribers := slices.DeleteFunc(jobSubscribers[jobID], func(sub chan JobEvent) bool {
+		return sub == ch
+	})
+	if len(subscribers) == 0 {
+		delete(jobSubscribers, jobID)
+		return
+	}
+	jobSubscribers[jobID] = subscribers
+}
+
+func handleEvents(c *gin.Context) {
+	jobID := c.Param("jobID")
+
+	if getJobStatus(jobID) == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job ID not found",
+		})
+		return
+	}
+
+	ch, event := subscribeJob(jobID)
+	defer unsubscribeJob(jobID, ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("status", event)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for event.Status != "" && !isTerminalStatus(event.Status) {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event = <-ch:
+			c.SSEvent("status", event)
+		}
+		c.Writer.Flush()
+	}
+}
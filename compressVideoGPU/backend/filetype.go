@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const sniffLength = 512
+
+// defaultAllowedExtensions are the extensions of videoTypeExtensions, the
+// formats content sniffing accepts.
+var defaultAllowedExtensions = []string{
+	".mp4", ".m4v", ".mov", ".webm", ".mkv", ".avi", ".flv", ".ts", ".m2ts", ".mts", ".mpg", ".mpeg",
+}
+
+// dangerousExtensions are refused anywhere in a name, so clip.exe.mp4 is
+// rejected just like clip.mp4.exe, whatever ALLOWED_EXTENSIONS says.
+var dangerousExtensions = []string{
+	".exe", ".com", ".bat", ".cmd", ".scr", ".msi", ".dll", ".ps1", ".vbs", ".js", ".jar", ".sh", ".app", ".apk",
+}
+
+var allowedExtensions = defaultAllowedExtensions
+
+func loadAllowedExtensions() ([]string, error) {
+	value := os.Getenv("ALLOWED_EXTENSIONS")
+	if value == "" {
+		return defaultAllowedExtensions, nil
+	}
+
+	var extensions []string
+	for _, part := range strings.Split(value, ",") {
+		ext := "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(part)), ".")
+		if ext == "." || strings.ContainsAny(ext[1:], "./\\") {
+			return nil, fmt.Errorf("invalid ALLOWED_EXTENSIONS %q: must be comma-separated extensions such as mp4,mov", value)
+		}
+		if slices.Contains(dangerousExtensions, ext) {
+			return nil, fmt.Errorf("invalid ALLOWED_EXTENSIONS %q: %s is never allowed", value, ext)
+		}
+		if !slices.Contains(extensions, ext) {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions, nil
+}
+
+// checkFilenameExtension accepts a name whose last extension is allowed and
+// none of whose extensions is dangerous, ignoring case.
+func checkFilenameExtension(filename string) error {
+	name := strings.ToLower(filename)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 || parts[len(parts)-1] == "" {
+		return fmt.Errorf("file has no extension: must be one of %s", strings.Join(allowedExtensions, ", "))
+	}
+	for _, part := range parts[1:] {
+		if slices.Contains(dangerousExtensions, "."+strings.TrimSpace(part)) {
+			return fmt.Errorf("extension .%s is not allowed", part)
+		}
+	}
+	if ext := "." + parts[len(parts)-1]; !slices.Contains(allowedExtensions, ext) {
+		return fmt.Errorf("extension %s is not allowed: must be one of %s", ext, strings.Join(allowedExtensions, ", "))
+	}
+	return nil
+}
+
+// videoTypeExtensions maps each accepted content type to the extensions a
+// file of that type may keep; the first one is used when the name has none
+// or an unrelated one. http.DetectContentType reports Matroska as webm.
+var videoTypeExtensions = map[string][]string{
+	"video/mp4":       {".mp4", ".m4v"},
+	"video/quicktime": {".mov"},
+	"video/webm":      {".webm", ".mkv"},
+	"video/avi":       {".avi"},
+	"video/x-flv":     {".flv"},
+	"video/mp2t":      {".ts", ".m2ts", ".mts"},
+	"video/mpeg":      {".mpg", ".mpeg"},
+}
+
+const (
+	tsPacketSize   = 188
+	m2tsPacketSize = 192
+)
+
+// legacyQuickTimeAtoms start QuickTime files written before the ftyp box
+// existed.
+var legacyQuickTimeAtoms = []string{"moov", "mdat", "wide", "free", "skip", "pnot"}
+
+// detectVideoType sniffs the header bytes of an upload. On top of the
+// net/http signatures it recognizes QuickTime with or without an ftyp box,
+// FLV, MPEG-PS, MPEG-TS and the timecoded M2TS packets of AVCHD cameras,
+// which DetectContentType reports as application/octet-stream.
+func detectVideoType(header []byte) (string, error) {
+	contentType, _, _ := strings.Cut(http.DetectContentType(header), ";")
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp" && string(header[8:12]) == "qt  ":
+		contentType = "video/quicktime"
+	case len(header) >= 8 && slices.Contains(legacyQuickTimeAtoms, string(header[4:8])):
+		contentType = "video/quicktime"
+	case bytes.HasPrefix(header, []byte("FLV\x01")):
+		contentType = "video/x-flv"
+	case bytes.HasPrefix(header, []byte("\x00\x00\x01\xBA")):
+		contentType = "video/mpeg"
+	case transportStream(header, 0, tsPacketSize), transportStream(header, 4, m2tsPacketSize):
+		contentType = "video/mp2t"
+	}
+
+	if _, ok := videoTypeExtensions[contentType]; !ok {
+		return "", fmt.Errorf("unsupported file type %s: must be a video", contentType)
+	}
+	return contentType, nil
+}
+
+// transportStream reports whether the header holds three consecutive
+// packets of the given size with the 0x47 sync byte at offset.
+func transportStream(header []byte, offset, packetSize int) bool {
+	if len(header) <= offset+2*packetSize {
+		return false
+	}
+	for i := range 3 {
+		if header[offset+i*packetSize] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
+
+func videoExtension(filename, contentType string) string {
+	extensions := videoTypeExtensions[contentType]
+	if ext := strings.ToLower(filepath.Ext(filename)); slices.Contains(extensions, ext) {
+		return ext
+	}
+	return extensions[0]
+}
+
+func readHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+func detectUploadedVideo(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	header, err := readHeader(src)
+	if err != nil {
+		return "", err
+	}
+	return detectVideoType(header)
+}
+
+func detectVideoFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header, err := readHeader(f)
+	if err != nil {
+		return "", err
+	}
+	return detectVideoType(header)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func packets(offset, packetSize, count int) []byte {
+	header := make([]byte, 0, count*packetSize)
+	for range count {
+		packet := make([]byte, packetSize)
+		packet[offset] = 0x47
+		header = append(header, packet...)
+	}
+	return header[:min(len(header), sniffLength)]
+}
+
+func TestDetectVideoType(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", append([]byte("\x00\x00\x00\x18ftypmp42"), make([]byte, 16)...), "video/mp4"},
+		{"quicktime ftyp", append([]byte("\x00\x00\x00\x14ftypqt  "), make([]byte, 16)...), "video/quicktime"},
+		{"quicktime without ftyp", append([]byte("\x00\x00\x00\x08wide\x00\x01\x00\x00mdat"), make([]byte, 16)...), "video/quicktime"},
+		{"quicktime moov first", append([]byte("\x00\x00\x10\x00moov\x00\x00\x00\x6cmvhd"), make([]byte, 16)...), "video/quicktime"},
+		{"mpeg-ts", packets(0, tsPacketSize, 3), "video/mp2t"},
+		{"m2ts", packets(4, m2tsPacketSize, 3), "video/mp2t"},
+		{"mpeg-ps", append([]byte("\x00\x00\x01\xBA\x44\x00\x04\x00\x04\x01"), make([]byte, 32)...), "video/mpeg"},
+		{"flv", append([]byte("FLV\x01\x05\x00\x00\x00\x09"), make([]byte, 16)...), "video/x-flv"},
+		{"matroska", append([]byte("\x1A\x45\xDF\xA3"), make([]byte, 16)...), "video/webm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectVideoType(tt.header)
+			if err != nil || got != tt.want {
+				t.Errorf("detectVideoType() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectVideoTypeRejectsNonVideo(t *testing.T) {
+	for name, header := range map[string][]byte{
+		"png":            []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"text":           []byte("hello world, this is not a video"),
+		"truncated m2ts": packets(4, m2tsPacketSize, 2),
+		"stray sync":     append([]byte{0x47}, bytes.Repeat([]byte{0}, 400)...),
+	} {
+		if got, err := detectVideoType(header); err == nil {
+			t.Errorf("%s: detectVideoType() = %q, want an error", name, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const maxTargetFPS = 120
+
+// parseFrameRate turns ffprobe's rational rates ("30000/1001") and plain
+// numbers ("25") into a two-decimal string. Anything that does not describe a
+// positive, finite rate, such as "0/0" for streams without timing, yields "".
+func parseFrameRate(frameRate string) string {
+	numText, denText, isRatio := strings.Cut(strings.TrimSpace(frameRate), "/")
+	num, err := strconv.ParseFloat(numText, 64)
+	if err != nil {
+		return ""
+	}
+
+	den := 1.0
+	if isRatio {
+		den, err = strconv.ParseFloat(denText, 64)
+		if err != nil || den == 0 {
+			return ""
+		}
+	}
+
+	rate := num / den
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", rate)
+}
+
+func (o CompressionOptions) validateTargetFPS(sourceFrameRate string) error {
+	if o.TargetFPS == 0 {
+		return nil
+	}
+	source, err := strconv.ParseFloat(sourceFrameRate, 64)
+	if err != nil || source <= 0 {
+		return nil
+	}
+	if o.TargetFPS > source+0.01 {
+		return fmt.Errorf("targetFps %g is higher than the source frame rate of %s", o.TargetFPS, sourceFrameRate)
+	}
+	return nil
+}
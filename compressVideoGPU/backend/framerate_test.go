@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"30000/1001", "29.97"},
+		{"25/1", "25.00"},
+		{"25", "25.00"},
+		{" 24 ", "24.00"},
+		{"0/0", ""},
+		{"30000/0", ""},
+		{"-25", ""},
+		{"-30000/1001", ""},
+		{"0", ""},
+		{"", ""},
+		{"abc", ""},
+		{"30/abc", ""},
+		{"1e400", ""},
+	}
+	for _, tt := range tests {
+		if got := parseFrameRate(tt.input); got != tt.want {
+			t.Errorf("parseFrameRate(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var cuvidDecodableCodecs = []string{"h264", "hevc", "av1", "vp8", "vp9", "mpeg1video", "mpeg2video", "mpeg4", "vc1"}
+
+// gpuReprobeInterval is how long NVENC stays marked unavailable before the
+// next gpuAvailable call probes it again, so a driver hiccup or a GPU that
+// comes back after a reset does not leave the server on the CPU for good.
+const gpuReprobeInterval = time.Minute
+
+var (
+	gpuScalingOnce      sync.Once
+	gpuScalingSupported bool
+	gpuUsable           atomic.Bool
+	gpuProbedAt         atomic.Int64
+	gpuProbeMutex       sync.Mutex
+)
+
+var (
+	gpuDevices []int
+	nextGPU    int
+	gpuMutex   sync.Mutex
+)
+
+func probeGPU() bool {
+	err := exec.Command(
+		ffmpegPath,
+		"-hide_banner",
+		"-v", "error",
+		"-f", "lavfi",
+		"-i", "color=black:s=256x256:d=0.1",
+		"-c:v", "h264_nvenc",
+		"-f", "null",
+		"-",
+	).Run()
+	gpuUsable.Store(err == nil)
+	gpuProbedAt.Store(time.Now().UnixNano())
+	return err == nil
+}
+
+// gpuAvailable reports whether NVENC can be used. Once gpuReprobeInterval
+// has passed since NVENC was found unusable, one caller probes it again while
+// the others keep getting false instead of waiting for the probe.
+func gpuAvailable() bool {
+	if gpuUsable.Load() {
+		return true
+	}
+	if !gpuReprobeDue() || !gpuProbeMutex.TryLock() {
+		return false
+	}
+	defer gpuProbeMutex.Unlock()
+	if !gpuReprobeDue() {
+		return gpuUsable.Load()
+	}
+	return probeGPU()
+}
+
+func gpuReprobeDue() bool {
+	return time.Since(time.Unix(0, gpuProbedAt.Load())) >= gpuReprobeInterval
+}
+
+func markGPUUnavailable() {
+	gpuUsable.Store(false)
+	gpuProbedAt.Store(time.Now().UnixNano())
+}
+
+func detectGPUCount() int {
+	output, err := exec.Command("nvidia-smi", "-L").Output()
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "GPU ") {
+			count++
+		}
+	}
+	return count
+}
+
+// loadGPUDevices lists the device indices jobs may run on: every GPU reported
+// by nvidia-smi, or the subset named in GPU_DEVICES.
+func loadGPUDevices() ([]int, error) {
+	count := detectGPUCount()
+
+	value := os.Getenv("GPU_DEVICES")
+	if value == "" {
+		devices := make([]int, count)
+		for i := range devices {
+			devices[i] = i
+		}
+		return devices, nil
+	}
+
+	var devices []int
+	for _, part := range strings.Split(value, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid GPU_DEVICES %q: must be comma-separated device indices such as 0,2", value)
+		}
+		if count > 0 && index >= count {
+			return nil, fmt.Errorf("invalid GPU_DEVICES %q: device %d does not exist, nvidia-smi reports %d GPUs", value, index, count)
+		}
+		if !slices.Contains(devices, index) {
+			devices = append(devices, index)
+		}
+	}
+	return devices, nil
+}
+
+func setGPUDevices(devices []int) {
+	gpuMutex.Lock()
+	defer gpuMutex.Unlock()
+	gpuDevices = devices
+	nextGPU = 0
+}
+
+// assignGPU hands out the usable devices round-robin. It returns nil when no
+// device is known, leaving the choice to NVENC's default of device 0.
+func assignGPU() *int {
+	gpuMutex.Lock()
+	defer gpuMutex.Unlock()
+	if len(gpuDevices) == 0 {
+		return nil
+	}
+	device := gpuDevices[nextGPU%len(gpuDevices)]
+	nextGPU++
+	return &device
+}
+
+func encoderType(encoder string) string {
+	if isNVENC(encoder) {
+		return "GPU"
+	}
+	return "CPU"
+}
+
+func supportsGPUDecodeScaling(sourceCodec string) bool {
+	if !slices.Contains(cuvidDecodableCodecs, sourceCodec) {
+		return false
+	}
+
+	gpuScalingOnce.Do(func() {
+		hwaccels, err := exec.Command(ffmpegPath, "-hide_banner", "-hwaccels").Output()
+		if err != nil || !strings.Contains(string(hwaccels), "cuda") {
+			return
+		}
+		filters, err := exec.Command(ffmpegPath, "-hide_banner", "-filters").Output()
+		gpuScalingSupported = err == nil && strings.Contains(string(filters), "scale_cuda")
+	})
+	return gpuScalingSupported
+}
+
+func scaledWidth(width, height, targetHeight int) int {
+	if height <= 0 {
+		return 0
+	}
+	return (width*targetHeight + height) / (2 * height) * 2
+}
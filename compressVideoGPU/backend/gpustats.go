@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	gpuStatsInterval = 5 * time.Second
+	gpuStatsTimeout  = 3 * time.Second
+	gpuStatsQuery    = "index,name,utilization.gpu,utilization.encoder,memory.used,memory.total,encoder.stats.sessionCount"
+)
+
+type GPUStats struct {
+	Index              int    `json:"index"`
+	Name               string `json:"name"`
+	UtilizationPercent int    `json:"utilizationPercent"`
+	EncoderPercent     int    `json:"encoderPercent"`
+	MemoryUsedMB       int64  `json:"memoryUsedMB"`
+	MemoryTotalMB      int64  `json:"memoryTotalMB"`
+	EncoderSessions    int    `json:"encoderSessions"`
+}
+
+var (
+	gpuStats        []GPUStats
+	gpuStatsError   string
+	gpuStatsUpdated time.Time
+	gpuStatsMutex   sync.RWMutex
+)
+
+var (
+	gpuUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gpuscale_gpu_utilization_percent",
+		Help: "GPU core utilization reported by nvidia-smi.",
+	}, []string{"gpu"})
+	gpuEncoderUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gpuscale_gpu_encoder_utilization_percent",
+		Help: "NVENC utilization reported by nvidia-smi.",
+	}, []string{"gpu"})
+	gpuMemoryUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gpuscale_gpu_memory_used_bytes",
+		Help: "GPU memory in use.",
+	}, []string{"gpu"})
+	gpuMemoryTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gpuscale_gpu_memory_total_bytes",
+		Help: "Total GPU memory.",
+	}, []string{"gpu"})
+	gpuEncoderSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gpuscale_gpu_encoder_sessions",
+		Help: "Active NVENC sessions on the GPU.",
+	}, []string{"gpu"})
+)
+
+func init() {
+	prometheus.MustRegister(gpuUtilization, gpuEncoderUtilization, gpuMemoryUsed, gpuMemoryTotal, gpuEncoderSessions)
+}
+
+// parseGPUStats reads the CSV nvidia-smi prints for gpuStatsQuery without a
+// header or units. Fields the driver can't report show up as "[N/A]" and
+// are left at zero.
+func parseGPUStats(output string) ([]GPUStats, error) {
+	var stats []GPUStats
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected GPU index %q", fields[0])
+		}
+		gpu := GPUStats{Index: index, Name: fields[1]}
+		gpu.UtilizationPercent, _ = strconv.Atoi(fields[2])
+		gpu.EncoderPercent, _ = strconv.Atoi(fields[3])
+		gpu.MemoryUsedMB, _ = strconv.ParseInt(fields[4], 10, 64)
+		gpu.MemoryTotalMB, _ = strconv.ParseInt(fields[5], 10, 64)
+		gpu.EncoderSessions, _ = strconv.Atoi(fields[6])
+		stats = append(stats, gpu)
+	}
+	return stats, nil
+}
+
+func queryGPUStats() ([]GPUStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gpuStatsTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu="+gpuStatsQuery, "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseGPUStats(string(output))
+}
+
+func refreshGPUStats() {
+	stats, err := queryGPUStats()
+
+	gpuStatsMutex.Lock()
+	gpuStats, gpuStatsError, gpuStatsUpdated = stats, "", time.Now()
+	if err != nil {
+		gpuStatsError = err.Error()
+	}
+	gpuStatsMutex.Unlock()
+
+	for _, gpu := range stats {
+		label := strconv.Itoa(gpu.Index)
+		gpuUtilization.WithLabelValues(label).Set(float64(gpu.UtilizationPercent))
+		gpuEncoderUtilization.WithLabelValues(label).Set(float64(gpu.EncoderPercent))
+		gpuMemoryUsed.WithLabelValues(label).Set(float64(gpu.MemoryUsedMB) * 1024 * 1024)
+		gpuMemoryTotal.WithLabelValues(label).Set(float64(gpu.MemoryTotalMB) * 1024 * 1024)
+		gpuEncoderSessions.WithLabelValues(label).Set(float64(gpu.EncoderSessions))
+	}
+}
+
+// startGPUStats polls nvidia-smi in the background so /gpu and /metrics
+// answer from the cache instead of forking a process per request. Hosts
+// without nvidia-smi are not polled at all.
+func startGPUStats() bool {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return false
+	}
+
+	refreshGPUStats()
+	go func() {
+		ticker := time.NewTicker(gpuStatsInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			refreshGPUStats()
+		}
+	}()
+	return true
+}
+
+func handleGPUStats(c *gin.Context) {
+	gpuStatsMutex.RLock()
+	stats, statsErr, updated := gpuStats, gpuStatsError, gpuStatsUpdated
+	gpuStatsMutex.RUnlock()
+
+	if len(stats) == 0 {
+		response := gin.H{
+			"status": "no gpu",
+			"gpus":   []GPUStats{},
+		}
+		if statsErr != "" {
+			response["details"] = statsErr
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "ok",
+		"gpus":      stats,
+		"updatedAt": updated,
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	modeHLS = "hls"
+
+	hlsMasterPlaylist = "master.m3u8"
+	hlsSegmentSeconds = 4.0
+	hlsMaxRenditions  = 3
+)
+
+var hlsLadderHeights = []int{1080, 720, 480}
+
+type HLSRendition struct {
+	Height   int    `json:"height"`
+	Bitrate  string `json:"bitrate"`
+	Playlist string `json:"playlist"`
+}
+
+func (o CompressionOptions) hls() bool {
+	return o.Mode == modeHLS
+}
+
+func hlsDir(jobID string) string {
+	return filepath.Join(staticDir, jobID)
+}
+
+// hlsLadder picks the renditions for a source: every ladder rung the source
+// (or maxHeight) can fill, or the source height alone when it is smaller than
+// the lowest rung. Upscaled renditions would only waste bandwidth.
+func hlsLadder(sourceHeight, maxHeight int) []HLSRendition {
+	limit := sourceHeight
+	if maxHeight > 0 && (limit <= 0 || maxHeight < limit) {
+		limit = maxHeight
+	}
+
+	var renditions []HLSRendition
+	for _, height := range hlsLadderHeights {
+		if limit > 0 && height > limit {
+			continue
+		}
+		renditions = append(renditions, HLSRendition{Height: height})
+	}
+	if len(renditions) == 0 {
+		renditions = append(renditions, HLSRendition{Height: limit - limit%2})
+	}
+	renditions = renditions[:min(len(renditions), hlsMaxRenditions)]
+
+	for i := range renditions {
+		renditions[i].Bitrate = settings.videoBitrateFor(renditions[i].Height)
+		renditions[i].Playlist = fmt.Sprintf("stream_%d.m3u8", i)
+	}
+	return renditions
+}
+
+// buildHLSArgs encodes every rendition in one ffmpeg run: the filtered video
+// stream is split once per rendition and scaled, and var_stream_map pairs each scaled
+// video with its own copy of the audio. Keyframes are forced on segment
+// boundaries so all renditions switch cleanly.
+func buildHLSArgs(p encodeParams) []string {
+	args := []string{"-y"}
+	args = append(args, p.Trim...)
+	if p.Rotated {
+		args = append(args, rotationInputArgs()...)
+	}
+	args = append(args, "-i", p.Input)
+
+	var filters []string
+	if p.ToneMap {
+		filters = append(filters, toneMapFilter)
+	}
+	if p.TargetFPS > 0 {
+		filters = append(filters, "fps="+strconv.FormatFloat(p.TargetFPS, 'f', -1, 64))
+	}
+	if p.Denoise != "" {
+		filters = append(filters, p.Denoise)
+	}
+	filters = append(filters, p.ExtraFilters...)
+	if p.PixelFormat != "" {
+		filters = append(filters, "format="+p.PixelFormat)
+	}
+
+	graph := fmt.Sprintf("[0:v:%d]", p.VideoStream)
+	if len(filters) > 0 {
+		graph += strings.Join(filters, ",") + ","
+	}
+	graph += fmt.Sprintf("split=%d", len(p.Renditions))
+	for i := range p.Renditions {
+		graph += fmt.Sprintf("[s%d]", i)
+	}
+	for i, rendition := range p.Renditions {
+		scale := fmt.Sprintf("scale=-2:%d", rendition.Height)
+		if p.Sharpen != "" {
+			scale += "," + p.Sharpen
+		}
+		graph += fmt.Sprintf(";[s%d]%s[v%d]", i, scale, i)
+	}
+	args = append(args, "-filter_complex", graph)
+
+	withAudio := p.AudioMode != audioModeStrip
+	var streamMap []string
+	for i := range p.Renditions {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		if withAudio {
+			args = append(args, "-map", "0:a:0")
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d", i, i))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d", i))
+		}
+	}
+
+	args = append(args, "-c:v", p.Encoder)
+	if p.GPU != nil && isNVENC(p.Encoder) {
+		args = append(args, "-gpu", strconv.Itoa(*p.GPU))
+	}
+	args = append(args, "-preset", settings.presetFor(p.Encoder, p.Preset))
+	for i, rendition := range p.Renditions {
+		bits := bitrateBits(rendition.Bitrate)
+		args = append(args,
+			fmt.Sprintf("-b:v:%d", i), rendition.Bitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), strconv.FormatInt(bits*3/2, 10),
+			fmt.Sprintf("-bufsize:v:%d", i), strconv.FormatInt(bits*2, 10),
+		)
+	}
+	segmentSeconds := hlsSegmentSeconds
+	if p.GOP > 0 {
+		args = append(args, keyframeArgs(p.Encoder, p.GOP, p.GOPSeconds)...)
+		segmentSeconds = p.GOPSeconds
+	}
+	if p.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(p.Threads))
+	}
+	if p.ToneMap {
+		args = append(args, "-color_primaries", "bt709", "-color_trc", "bt709", "-colorspace", "bt709")
+	}
+	if p.Rotated {
+		args = append(args, rotationOutputArgs()...)
+	}
+
+	if withAudio {
+		audioBitrate := p.AudioBitrate
+		if audioBitrate == "" {
+			audioBitrate = settings.AudioBitrate
+		}
+		args = append(args, "-c:a", "aac", "-b:a", audioBitrate)
+		if p.AudioFilter != "" {
+			args = append(args, "-af", p.AudioFilter, "-ar", loudnessSampleRate)
+		}
+	}
+
+	dir := filepath.Dir(p.Output)
+	return append(args,
+		"-f", "hls",
+		"-hls_time", strconv.FormatFloat(segmentSeconds, 'f', -1, 64),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "stream_%v_%05d.ts"),
+		"-master_pl_name", filepath.Base(p.Output),
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(dir, "stream_%v.m3u8"),
+	)
+}
+
+// hlsOutputSize adds up the playlists and segments of a job, the HLS
+// counterpart of the output file size.
+func hlsOutputSize(jobID string) int64 {
+	var size int64
+	filepath.WalkDir(hlsDir(jobID), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func removeHLSOutput(jobID string) {
+	if err := os.RemoveAll(hlsDir(jobID)); err != nil {
+		jobLogger(jobID).Warn("Failed to remove HLS output", "error", err)
+	}
+}
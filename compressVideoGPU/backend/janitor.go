@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFileTTL  = 24 * time.Hour
+	janitorInterval = 10 * time.Minute
+)
+
+func fileTTL() (time.Duration, error) {
+	value := os.Getenv("FILE_TTL")
+	if value == "" {
+		return defaultFileTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid FILE_TTL %q: must be a positive duration such as 24h", value)
+	}
+	return ttl, nil
+}
+
+func isActiveStatus(status string) bool {
+	return status == "processing" || status == "queued" || status == "uploading"
+}
+
+func startJanitor(ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(min(ttl, janitorInterval))
+		defer ticker.Stop()
+
+		for range ticker.C {
+			cleanupExpired(ttl)
+		}
+	}()
+}
+
+func cleanupExpired(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+
+	cleanupStaleUploads(ttl)
+
+	for _, jobID := range findJobs(JobFilter{OlderThan: cutoff}) {
+		status := getJobStatus(jobID)
+		if isActiveStatus(status) {
+			continue
+		}
+
+		removeJobFiles(jobID)
+		deleteJob(jobID)
+		jobLogger(jobID).Info("Janitor removed expired job", "event", "janitor", "status", status, "ttl", ttl.String())
+	}
+
+	for _, dir := range []string{uploadDir, staticDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			slog.Warn("Janitor failed to read directory", "dir", dir, "error", err)
+			continue
+		}
+
+		for _, entry := range entries {
+			jobID, _, found := strings.Cut(entry.Name(), "_")
+			if entry.IsDir() && dir == staticDir {
+				// HLS jobs keep their playlists and segments in a directory
+				// named after the job.
+				jobID, found = entry.Name(), true
+			} else if entry.IsDir() {
+				continue
+			}
+			if !found || getJobStatus(jobID) != "" {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if err := os.RemoveAll(path); err != nil {
+				slog.Warn("Janitor failed to remove file", "path", path, "error", err)
+				continue
+			}
+			slog.Info("Janitor removed orphaned file", "event", "janitor", "path", path)
+		}
+	}
+
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		slog.Warn("Janitor failed to read directory", "dir", logDir, "error", err)
+		return
+	}
+	for _, entry := range entries {
+		jobID, found := strings.CutSuffix(entry.Name(), ".log")
+		if entry.IsDir() || !found || getJobStatus(jobID) != "" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		removeJobLog(jobID)
+		slog.Info("Janitor removed orphaned log", "event", "janitor", "path", entry.Name())
+	}
+}
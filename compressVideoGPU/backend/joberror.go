@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	jobErrorOutputLines = 20
+	jobErrorOutputBytes = 2048
+)
+
+var absolutePathPattern = regexp.MustCompile(`(^|[\s'"=(\[,])(/[^\s'"()\[\],]+)`)
+
+type JobError struct {
+	Phase    string `json:"phase,omitempty"`
+	Message  string `json:"message"`
+	ExitCode int    `json:"exitCode,omitempty"`
+	Output   string `json:"output,omitempty"`
+}
+
+func newJobError(err error, output []byte) *JobError {
+	jobErr := &JobError{
+		Message: redactPaths(err.Error()),
+		Output:  redactPaths(outputTail(output)),
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		jobErr.ExitCode = exitErr.ExitCode()
+	}
+	return jobErr
+}
+
+func outputTail(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) > jobErrorOutputLines {
+		lines = lines[len(lines)-jobErrorOutputLines:]
+	}
+
+	tail := strings.Join(lines, "\n")
+	if len(tail) > jobErrorOutputBytes {
+		tail = tail[len(tail)-jobErrorOutputBytes:]
+	}
+	return tail
+}
+
+// redactPaths keeps only the base name of absolute paths so failures don't
+// reveal the server's filesystem layout.
+func redactPaths(message string) string {
+	return absolutePathPattern.ReplaceAllStringFunc(message, func(match string) string {
+		groups := absolutePathPattern.FindStringSubmatch(match)
+		return groups[1] + filepath.Base(groups[2])
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultLogDir = "./logs"
+
+var logDir = defaultLogDir
+
+func jobLogDir() string {
+	if value := os.Getenv("LOG_DIR"); value != "" {
+		return filepath.Clean(value)
+	}
+	return defaultLogDir
+}
+
+func jobLogPath(jobID string) string {
+	return filepath.Join(logDir, jobID+".log")
+}
+
+// openJobLog appends to the job's log so every ffmpeg run of a job, including
+// retries and extra passes, ends up in one file. A nil file means logging is
+// unavailable and the caller carries on without it.
+func openJobLog(jobID string, args []string) *os.File {
+	file, err := os.OpenFile(jobLogPath(jobID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		jobLogger(jobID).Warn("Failed to open ffmpeg log", "error", err)
+		return nil
+	}
+	fmt.Fprintf(file, "[%s] ffmpeg %s\n", time.Now().Format(time.RFC3339), strings.Join(args, " "))
+	return file
+}
+
+func removeJobLog(jobID string) {
+	if err := os.Remove(jobLogPath(jobID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		jobLogger(jobID).Warn("Failed to remove ffmpeg log", "error", err)
+	}
+}
+
+func handleLogs(c *gin.Context) {
+	jobID := c.Param("jobID")
+
+	if getJobStatus(jobID) == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job ID not found",
+		})
+		return
+	}
+
+	path := jobLogPath(jobID)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No ffmpeg log has been written for this job yet",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.File(path)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultJobsPageSize = 50
+	maxJobsPageSize     = 200
+)
+
+type JobSummary struct {
+	JobID            string    `json:"jobID"`
+	Status           string    `json:"status"`
+	CreatedAt        time.Time `json:"createdAt"`
+	Label            string    `json:"label,omitempty"`
+	OriginalSize     int64     `json:"originalSize,omitempty"`
+	CompressedSize   int64     `json:"compressedSize,omitempty"`
+	CompressionRatio string    `json:"compressionRatio,omitempty"`
+	ProcessingTime   string    `json:"processingTime,omitempty"`
+}
+
+type JobFilter struct {
+	Status    string    `json:"status"`
+	OlderThan time.Time `json:"olderThan"`
+	Label     string    `json:"label"`
+}
+
+func (f JobFilter) empty() bool {
+	return f.Status == "" && f.OlderThan.IsZero() && f.Label == ""
+}
+
+func (f JobFilter) matches(status string, created time.Time, opts CompressionOptions) bool {
+	if f.Status != "" && status != f.Status {
+		return false
+	}
+	if !f.OlderThan.IsZero() && !created.Before(f.OlderThan) {
+		return false
+	}
+	if f.Label != "" && opts.Label != f.Label {
+		return false
+	}
+	return true
+}
+
+func adminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Admin endpoints are disabled; set ADMIN_TOKEN to enable them",
+			})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func handleBulkDelete(c *gin.Context) {
+	var filter JobFilter
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if filter.empty() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one of status, olderThan or label is required",
+		})
+		return
+	}
+
+	deleted, cancelled := 0, 0
+	for _, jobID := range findJobs(filter) {
+		if _, ok := cancelJob(jobID); ok {
+			cancelled++
+		}
+
+		removeJobFiles(jobID)
+		deleteJob(jobID)
+		deleted++
+	}
+
+	slog.Info("Bulk delete removed jobs", "event", "jobs_deleted", "count", deleted, "cancelled", cancelled)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted":   deleted,
+		"cancelled": cancelled,
+	})
+}
+
+func handleCancel(c *gin.Context) {
+	jobID := c.Param("jobID")
+
+	status, ok := cancelJob(jobID)
+	if status == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job ID not found",
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  fmt.Sprintf("Job is already %s", status),
+			"status": status,
+		})
+		return
+	}
+
+	jobLogger(jobID).Info("Cancelled job", "event", "job_cancelled", "status", "cancelled")
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobID":  jobID,
+		"status": "cancelled",
+	})
+}
+
+func findJobs(filter JobFilter) []string {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+
+	var matched []string
+	for jobID, job := range jobsByID {
+		if filter.matches(job.Status, job.Created, job.Options) {
+			matched = append(matched, jobID)
+		}
+	}
+	return matched
+}
+
+func listJobs(filter JobFilter) []JobSummary {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+
+	summaries := []JobSummary{}
+	for jobID, job := range jobsByID {
+		if !filter.matches(job.Status, job.Created, job.Options) {
+			continue
+		}
+
+		summary := JobSummary{
+			JobID:     jobID,
+			Status:    job.Status,
+			CreatedAt: job.Created,
+			Label:     job.Options.Label,
+		}
+		if metrics := job.Metrics; metrics != nil {
+			summary.OriginalSize = metrics.Original.Size
+			summary.CompressedSize = metrics.Compressed.Size
+			summary.CompressionRatio = metrics.CompressionRatio
+			summary.ProcessingTime = metrics.ProcessingTime
+		}
+		summaries = append(summaries, summary)
+	}
+
+	slices.SortFunc(summaries, func(a, b JobSummary) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.JobID, b.JobID)
+	})
+	return summaries
+}
+
+func handleListJobs(c *gin.Context) {
+	filter := JobFilter{
+		Status: c.Query("status"),
+		Label:  c.Query("label"),
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid page %q: must be a positive integer", c.Query("page")),
+		})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultJobsPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxJobsPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid pageSize %q: must be between 1 and %d", c.Query("pageSize"), maxJobsPageSize),
+		})
+		return
+	}
+
+	jobs := listJobs(filter)
+	start := min((page-1)*pageSize, len(jobs))
+	end := min(start+pageSize, len(jobs))
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":     jobs[start:end],
+		"total":    len(jobs),
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+func removeJobFiles(jobID string) {
+	removeJobLog(jobID)
+	removeJobOutputs(jobID, getJobOptions(jobID))
+	removeHLSOutput(jobID)
+	for _, dir := range []string{uploadDir, staticDir} {
+		files, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s_*", jobID)))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				jobLogger(jobID).Warn("Failed to remove job file", "path", file, "error", err)
+			}
+		}
+	}
+}
+
+func deleteJob(jobID string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok {
+		unindexJobHashLocked(job)
+	}
+	delete(jobsByID, jobID)
+	discardJobRecordLocked(jobID)
+}
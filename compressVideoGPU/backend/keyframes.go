@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// maxKeyframeIntervalSeconds bounds the GOP length; beyond it seeking gets
+// sluggish and HLS/DASH segments grow too long to be useful.
+const maxKeyframeIntervalSeconds = 20
+
+func (o CompressionOptions) keyframeControl() bool {
+	return o.KeyframeInterval > 0 || o.GOPSize > 0
+}
+
+// gopFrames converts keyframeInterval or gopSize into a GOP length in frames
+// of the output and the matching interval in seconds.
+func (o CompressionOptions) gopFrames(sourceFrameRate string) (int, float64, error) {
+	if !o.keyframeControl() {
+		return 0, 0, nil
+	}
+
+	frameRate, _ := strconv.ParseFloat(sourceFrameRate, 64)
+	if o.TargetFPS > 0 {
+		frameRate = o.TargetFPS
+	}
+	if frameRate <= 0 {
+		return 0, 0, fmt.Errorf("source frame rate is unknown, the keyframe interval cannot be set")
+	}
+
+	frames := o.GOPSize
+	if o.KeyframeInterval > 0 {
+		frames = int(math.Round(o.KeyframeInterval * frameRate))
+	}
+	seconds := float64(frames) / frameRate
+	if frames < 1 {
+		return 0, 0, fmt.Errorf("keyframeInterval %gs is shorter than one frame at %g fps", o.KeyframeInterval, frameRate)
+	}
+	if seconds > maxKeyframeIntervalSeconds {
+		return 0, 0, fmt.Errorf("a GOP of %d frames lasts %ss at %g fps, more than the %ds maximum", frames, formatSeconds(seconds), frameRate, maxKeyframeIntervalSeconds)
+	}
+	return frames, seconds, nil
+}
+
+// keyframeArgs fixes the GOP length and forces a keyframe at every interval
+// boundary, so segmenters can cut on them. Scene-change keyframes in between
+// are left to the encoder.
+func keyframeArgs(encoder string, frames int, seconds float64) []string {
+	args := []string{
+		"-g", strconv.Itoa(frames),
+		"-keyint_min", strconv.Itoa(frames),
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%s)", strconv.FormatFloat(seconds, 'f', -1, 64)),
+	}
+	if isNVENC(encoder) {
+		args = append(args, "-forced-idr", "1")
+	}
+	return args
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupLogging writes every log line as one JSON object to stdout. Calls to
+// the standard log package, such as the fatal startup errors, go through the
+// same handler.
+func setupLogging() error {
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", value)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// jobLogger tags every line with the job, so the upload, compression and
+// completion of one job can be filtered together.
+func jobLogger(jobID string) *slog.Logger {
+	return slog.With("jobID", jobID)
+}
+
+// requestLogger replaces gin's text access log with one JSON line per
+// request, carrying the job ID for the job-scoped routes.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		attrs := []any{
+			"event", "http_request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"durationMs", time.Since(start).Milliseconds(),
+			"clientIP", c.ClientIP(),
+		}
+		if jobID := c.Param("jobID"); jobID != "" {
+			attrs = append(attrs, "jobID", jobID)
+		}
+
+		switch {
+		case c.Writer.Status() >= 500:
+			slog.Error("request", attrs...)
+		case c.Request.URL.Path == "/metrics" || c.Request.URL.Path == "/health" || c.Request.URL.Path == "/ready":
+			slog.Debug("request", attrs...)
+		default:
+			slog.Info("request", attrs...)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultLoudnessTarget = -16.0
+	minLoudnessTarget     = -70.0
+	maxLoudnessTarget     = -5.0
+	loudnessTruePeak      = -1.5
+	loudnessRange         = 11.0
+	// loudnorm upsamples to 192kHz internally and outputs that rate unless
+	// told otherwise.
+	loudnessSampleRate = "48000"
+
+	audioNormalizationSinglePass = "single-pass"
+	audioNormalizationTwoPass    = "two-pass"
+)
+
+// loudnessMeasurement is the JSON summary loudnorm prints after analyzing a
+// clip. The values are strings in ffmpeg's output.
+type loudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+func (o CompressionOptions) audioNormalization() string {
+	switch {
+	case !o.AudioNormalize:
+		return ""
+	case o.TwoPassAudio:
+		return audioNormalizationTwoPass
+	default:
+		return audioNormalizationSinglePass
+	}
+}
+
+// loudnormFilter targets EBU R128 at the given integrated loudness. With a
+// measurement from a first pass the filter applies a single linear gain
+// instead of adjusting dynamically, which keeps the original dynamics.
+func loudnormFilter(target float64, measured *loudnessMeasurement) string {
+	filter := fmt.Sprintf("loudnorm=I=%s:TP=%g:LRA=%g", strconv.FormatFloat(target, 'f', -1, 64), loudnessTruePeak, loudnessRange)
+	if measured != nil {
+		filter += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+	}
+	return filter
+}
+
+// loudnessMeasureArgs analyzes the audio track the encode will keep, over the
+// same trimmed range, without writing any output.
+func loudnessMeasureArgs(input string, trim []string, layout []AudioTrack, target float64) []string {
+	args := append([]string{"-y"}, trim...)
+	args = append(args, "-i", input, "-vn", "-sn")
+	if len(layout) > 0 {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d", layout[0].Index))
+	}
+	return append(args, "-af", loudnormFilter(target, nil)+":print_format=json", "-f", "null", os.DevNull)
+}
+
+func parseLoudnessMeasurement(output []byte) (*loudnessMeasurement, error) {
+	start, end := bytes.LastIndexByte(output, '{'), bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("loudnorm printed no measurement")
+	}
+
+	var measured loudnessMeasurement
+	if err := json.Unmarshal(output[start:end+1], &measured); err != nil {
+		return nil, fmt.Errorf("failed to parse loudnorm measurement: %v", err)
+	}
+	// Silence measures as -inf, which the second pass can't work with.
+	for _, value := range []string{measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset} {
+		if n, err := strconv.ParseFloat(value, 64); err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, fmt.Errorf("loudnorm measured %q, the audio is probably silent", value)
+		}
+	}
+	return &measured, nil
+}
@@ -1,64 +1,197 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	uploadDir   = "./uploads"
-	staticDir   = "./static"
 	frontendDir = "./frontend/dist"
-	maxFileSize = 500 * 1024 * 1024
+	maxHeight   = 4320
+
+	maxDeadlineSeconds = 24 * 60 * 60
+)
+
+const (
+	upscalePolicyWarn   = "warn"
+	upscalePolicyReject = "reject"
+	upscalePolicyClamp  = "clamp"
 )
 
 type VideoMetrics struct {
-	Width        int               `json:"width"`
-	Height       int               `json:"height"`
-	Duration     float64           `json:"duration"`
-	VideoCodec   string            `json:"videoCodec"`
-	AudioCodec   string            `json:"audioCodec"`
-	FrameRate    string            `json:"frameRate"`
-	Bitrate      int64             `json:"bitrate"`
-	VideoBitrate int64             `json:"videoBitrate"`
-	AudioBitrate int64             `json:"audioBitrate"`
-	Size         int64             `json:"size"`
-	PixelFormat  string            `json:"pixelFormat"`
-	ColorSpace   string            `json:"colorSpace"`
-	Metadata     map[string]string `json:"metadata,omitempty"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	Duration       float64           `json:"duration"`
+	VideoCodec     string            `json:"videoCodec"`
+	AudioCodec     string            `json:"audioCodec"`
+	FrameRate      string            `json:"frameRate"`
+	Bitrate        int64             `json:"bitrate"`
+	VideoBitrate   int64             `json:"videoBitrate"`
+	AudioBitrate   int64             `json:"audioBitrate"`
+	Size           int64             `json:"size"`
+	PixelFormat    string            `json:"pixelFormat"`
+	BitDepth       int               `json:"bitDepth,omitempty"`
+	ColorSpace     string            `json:"colorSpace"`
+	ColorRange     string            `json:"colorRange,omitempty"`
+	ColorTransfer  string            `json:"colorTransfer,omitempty"`
+	ColorPrimaries string            `json:"colorPrimaries,omitempty"`
+	Rotation       int               `json:"rotation,omitempty"`
+	AudioTracks    []AudioTrack      `json:"audioTracks,omitempty"`
+	SubtitleTracks []SubtitleTrack   `json:"subtitleTracks,omitempty"`
+	Streams        []StreamInfo      `json:"streams,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
 }
 
 type ComparisonMetrics struct {
-	Original         VideoMetrics `json:"original"`
-	Compressed       VideoMetrics `json:"compressed"`
-	CompressionRatio string       `json:"compressionRatio"`
-	ProcessingTime   string       `json:"processingTime,omitempty"`
+	Original           VideoMetrics    `json:"original"`
+	Compressed         VideoMetrics    `json:"compressed"`
+	CompressionRatio   string          `json:"compressionRatio"`
+	Diff               *MetricsDiff    `json:"diff,omitempty"`
+	ProcessingTime     string          `json:"processingTime,omitempty"`
+	Lossless           bool            `json:"lossless,omitempty"`
+	RateControl        string          `json:"rateControl"`
+	TwoPass            bool            `json:"twoPass,omitempty"`
+	QualityScore       *float64        `json:"qualityScore,omitempty"`
+	QualityMetric      string          `json:"qualityMetric,omitempty"`
+	TargetBitrate      string          `json:"targetBitrate,omitempty"`
+	BitrateHeuristic   string          `json:"bitrateHeuristic,omitempty"`
+	TargetSizeMB       float64         `json:"targetSizeMB,omitempty"`
+	CRF                *int            `json:"crf,omitempty"`
+	Encoder            string          `json:"encoder"`
+	EncoderType        string          `json:"encoderType"`
+	EncoderThreads     int             `json:"encoderThreads,omitempty"`
+	ResolutionDecision string          `json:"resolutionDecision,omitempty"`
+	MaxHeightDecision  string          `json:"maxHeightDecision,omitempty"`
+	WaveformURL        string          `json:"waveformURL,omitempty"`
+	ThumbnailURL       string          `json:"thumbnailURL,omitempty"`
+	DecodeResolution   string          `json:"decodeResolution,omitempty"`
+	GPUDecodeScaling   bool            `json:"gpuDecodeScaling,omitempty"`
+	GPU                *int            `json:"gpu,omitempty"`
+	Normalized         bool            `json:"normalized"`
+	NormalizeReason    string          `json:"normalizeReason,omitempty"`
+	PixelFormatReason  string          `json:"pixelFormatReason,omitempty"`
+	AudioNormalization string          `json:"audioNormalization,omitempty"`
+	LoudnessTarget     float64         `json:"loudnessTarget,omitempty"`
+	MeasuredLoudness   string          `json:"measuredLoudness,omitempty"`
+	ToneMapped         bool            `json:"toneMapped,omitempty"`
+	ToneMapReason      string          `json:"toneMapReason,omitempty"`
+	DeadlineDowngraded bool            `json:"deadlineDowngraded,omitempty"`
+	DeadlineMet        *bool           `json:"deadlineMet,omitempty"`
+	AudioLayout        []AudioTrack    `json:"audioLayout,omitempty"`
+	BitrateTimeline    []BitrateSample `json:"bitrateTimeline,omitempty"`
+	Renditions         []HLSRendition  `json:"renditions,omitempty"`
+	CreatedAt          time.Time       `json:"createdAt"`
+	StartedAt          time.Time       `json:"startedAt"`
+	CompletedAt        time.Time       `json:"completedAt"`
+	Warnings           []string        `json:"warnings,omitempty"`
+}
+
+type CompressionOptions struct {
+	Codec            string          `json:"codec"`
+	Lossless         bool            `json:"lossless"`
+	TargetHeight     int             `json:"targetHeight,omitempty"`
+	MaxHeight        int             `json:"maxHeight,omitempty"`
+	Threads          int             `json:"threads,omitempty"`
+	Label            string          `json:"label,omitempty"`
+	Priority         string          `json:"priority,omitempty"`
+	AudioVisual      string          `json:"audioVisual,omitempty"`
+	Fragmented       bool            `json:"fragmented,omitempty"`
+	TextWatermark    *TextWatermark  `json:"textWatermark,omitempty"`
+	BitrateTimeline  bool            `json:"bitrateTimeline,omitempty"`
+	Deadline         int             `json:"deadline,omitempty"`
+	AudioTracks      []string        `json:"audioTracks,omitempty"`
+	Streams          []int           `json:"streams,omitempty"`
+	Bitrate          string          `json:"bitrate,omitempty"`
+	QualityTier      string          `json:"qualityTier,omitempty"`
+	TargetSizeMB     float64         `json:"targetSizeMB,omitempty"`
+	CRF              *int            `json:"crf,omitempty"`
+	Maxrate          string          `json:"maxrate,omitempty"`
+	Bufsize          string          `json:"bufsize,omitempty"`
+	Container        string          `json:"container,omitempty"`
+	CallbackURL      string          `json:"callbackURL,omitempty"`
+	TwoPass          bool            `json:"twoPass,omitempty"`
+	MeasureQuality   bool            `json:"measureQuality,omitempty"`
+	AudioMode        string          `json:"audioMode,omitempty"`
+	AudioBitrate     string          `json:"audioBitrate,omitempty"`
+	AudioCodec       string          `json:"audioCodec,omitempty"`
+	AudioNormalize   bool            `json:"audioNormalize,omitempty"`
+	LoudnessTarget   float64         `json:"loudnessTarget,omitempty"`
+	TwoPassAudio     bool            `json:"twoPassAudio,omitempty"`
+	Preset           string          `json:"preset,omitempty"`
+	ToneMap          bool            `json:"toneMap,omitempty"`
+	ImageWatermark   *ImageWatermark `json:"imageWatermark,omitempty"`
+	StartTime        float64         `json:"startTime,omitempty"`
+	Duration         float64         `json:"duration,omitempty"`
+	OutputType       string          `json:"outputType,omitempty"`
+	AudioFormat      string          `json:"audioFormat,omitempty"`
+	Mode             string          `json:"mode,omitempty"`
+	TargetFPS        float64         `json:"targetFps,omitempty"`
+	KeyframeInterval float64         `json:"keyframeInterval,omitempty"`
+	GOPSize          int             `json:"gopSize,omitempty"`
+	Subtitles        string          `json:"subtitles,omitempty"`
+	SubtitleTrack    int             `json:"subtitleTrack,omitempty"`
+	StripMetadata    bool            `json:"stripMetadata,omitempty"`
+	FPS              int             `json:"fps,omitempty"`
+	Width            int             `json:"width,omitempty"`
+	Denoise          string          `json:"denoise,omitempty"`
+	DenoiseStrength  float64         `json:"denoiseStrength,omitempty"`
+	Sharpen          bool            `json:"sharpen,omitempty"`
+	SharpenStrength  float64         `json:"sharpenStrength,omitempty"`
+	VideoFilter      string          `json:"videoFilter,omitempty"`
+	BitDepth         int             `json:"bitDepth,omitempty"`
+}
+
+type Job struct {
+	ID        string
+	Status    string
+	Metrics   *ComparisonMetrics
+	Options   CompressionOptions
+	Created   time.Time
+	Started   time.Time
+	Completed time.Time
+	Input     string
+	Error     *JobError
+	Batch     string
+	InputHash string
+	Filename  string
+	Progress  *JobProgress
+	Upload    *UploadProgress
+	Resumes   int
+	cancel    context.CancelFunc
+	done      chan struct{}
 }
 
 var (
-	jobStatus  = make(map[string]string)
-	jobMetrics = make(map[string]*ComparisonMetrics)
-	jobMutex   sync.RWMutex
+	jobsByID = make(map[string]*Job)
+	jobMutex sync.RWMutex
 )
 
+var uploadCodecs = []string{"h264_nvenc", "hevc_nvenc", "av1_nvenc"}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key, X-Admin-Token, Upload-Offset, X-Upload-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -70,20 +203,164 @@ func corsMiddleware() gin.HandlerFunc {
 }
 
 func main() {
+	if err := setupLogging(); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
 
-	for _, dir := range []string{uploadDir, staticDir} {
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = defaultConfigFile
+	}
+
+	loaded, err := loadSettings(configFile)
+	if err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+	}
+	if policy := os.Getenv("UPSCALE_POLICY"); policy != "" {
+		loaded.UpscalePolicy = policy
+	}
+	if err := loaded.validate(); err != nil {
+		log.Fatalf("Invalid settings in %s: %v", configFile, err)
+	}
+	settings = loaded
+
+	ffmpegPath, ffprobePath, err = binaryConfig()
+	if err != nil {
+		log.Fatalf("FFmpeg is not usable: %v", err)
+	}
+
+	uploadDir, staticDir, maxFileSize, err = storageConfig()
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	maxDuration, err = maxDurationConfig()
+	if err != nil {
+		log.Fatalf("Invalid duration limit: %v", err)
+	}
+	outputs, err = loadOutputStore()
+	if err != nil {
+		log.Fatalf("Invalid output storage configuration: %v", err)
+	}
+
+	logDir = jobLogDir()
+
+	for _, dir := range []string{uploadDir, staticDir, logDir} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			log.Fatalf("Failed to create directory %s: %v", dir, err)
 		}
 	}
+	for _, dir := range []string{uploadDir, staticDir} {
+		if err := checkWritable(dir); err != nil {
+			log.Fatalf("Directory %s is not writable: %v", dir, err)
+		}
+	}
 
-	gin.SetMode(gin.ReleaseMode)
+	autoResume, err = autoResumeConfig()
+	if err != nil {
+		log.Fatalf("Invalid resume configuration: %v", err)
+	}
+	if err := loadStats(); err != nil {
+		log.Fatalf("Failed to restore stats: %v", err)
+	}
+	startJobRecordWriter()
+	restored, err := loadJobs()
+	if err != nil {
+		log.Fatalf("Failed to restore jobs: %v", err)
+	}
+	slog.Info("Restored jobs", "count", restored, "dir", uploadDir)
+
+	ffmpeg, encoders := ffmpegBuildInfo()
+	slog.Info("Probed ffmpeg build", "version", ffmpeg.Version, "nvencEncoders", encoders)
 
-	router := gin.Default()
+	if probeGPU() {
+		slog.Info("NVENC is available")
+	} else {
+		slog.Warn("NVENC is unavailable, jobs will fall back to CPU encoding")
+	}
+
+	devices, err := loadGPUDevices()
+	if err != nil {
+		log.Fatalf("Invalid GPU configuration: %v", err)
+	}
+	setGPUDevices(devices)
+	if len(devices) > 0 {
+		slog.Info("Assigning NVENC jobs round-robin across GPUs", "gpus", devices)
+	}
+
+	if startGPUStats() {
+		slog.Info("Polling nvidia-smi for GPU stats", "interval", gpuStatsInterval.String())
+	}
+
+	workers, err := workerCount()
+	if err != nil {
+		log.Fatalf("Invalid worker configuration: %v", err)
+	}
+	configuredNotifiers, err := loadNotifiers()
+	if err != nil {
+		log.Fatalf("Invalid notification configuration: %v", err)
+	}
+	startNotifiers(configuredNotifiers)
+	for _, n := range configuredNotifiers {
+		slog.Info("Sending job summaries", "notifier", n.Name())
+	}
+
+	startWorkers(workers)
+	slog.Info("Started compression workers", "workers", workers)
+
+	ttl, err := fileTTL()
+	if err != nil {
+		log.Fatalf("Invalid cleanup configuration: %v", err)
+	}
+	startJanitor(ttl)
+	slog.Info("Removing finished jobs and their files", "ttl", ttl.String())
+
+	allowedExtensions, err = loadAllowedExtensions()
+	if err != nil {
+		log.Fatalf("Invalid upload configuration: %v", err)
+	}
+
+	apiKeys, err := loadAPIKeys()
+	if err != nil {
+		log.Fatalf("Invalid API key configuration: %v", err)
+	}
+	if apiKeys == nil {
+		slog.Warn("API key authentication is disabled")
+	} else {
+		slog.Info("Loaded API keys", "count", len(apiKeys))
+	}
+
+	uploadLimit, uploadBurst, err := uploadRateLimits()
+	if err != nil {
+		log.Fatalf("Invalid rate limit configuration: %v", err)
+	}
+	var uploadLimiter *rateLimiter
+	if uploadLimit > 0 {
+		uploadLimiter = newRateLimiter(uploadLimit, uploadBurst)
+		slog.Info("Limiting uploads per client", "perMinute", uploadLimit, "burst", uploadBurst)
+	}
+
+	requireGPU, err := gpuRequired()
+	if err != nil {
+		log.Fatalf("Invalid readiness configuration: %v", err)
+	}
+
+	drainTimeout, err := shutdownTimeout()
+	if err != nil {
+		log.Fatalf("Invalid shutdown configuration: %v", err)
+	}
+
+	// gin's debug output would break the one JSON object per line on stdout.
+	if os.Getenv("GIN_MODE") == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	router := gin.New()
+	router.Use(requestLogger(), gin.Recovery())
 
 	router.Use(corsMiddleware())
 
-	router.MaxMultipartMemory = 32 << 20
+	router.MaxMultipartMemory = min(32<<20, maxFileSize)
+
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -93,10 +370,32 @@ func main() {
 		})
 	})
 
-	router.Static("/static", staticDir)
-
-	router.POST("/upload", handleUpload)
-	router.GET("/status/:jobID", handleStatus)
+	router.GET("/ready", handleReady(requireGPU))
+	router.GET("/gpu", handleGPUStats)
+	router.GET("/version", handleVersion)
+	router.GET("/stats", handleStats)
+
+	router.GET("/static/*filepath", handleStaticDownload)
+	router.HEAD("/static/*filepath", handleStaticDownload)
+
+	api := router.Group("", apiKeyMiddleware(apiKeys))
+	api.POST("/upload", acceptingUploads(), rateLimitMiddleware(uploadLimiter), handleUpload)
+	api.POST("/upload/init", acceptingUploads(), rateLimitMiddleware(uploadLimiter), handleUploadInit)
+	api.GET("/upload/:uploadID", handleUploadOffset)
+	api.PATCH("/upload/:uploadID", acceptingUploads(), handleUploadChunk)
+	api.POST("/upload/:uploadID/complete", acceptingUploads(), handleUploadComplete)
+	api.POST("/compress-url", acceptingUploads(), rateLimitMiddleware(uploadLimiter), handleCompressURL)
+	api.POST("/rejob/:jobID", acceptingUploads(), rateLimitMiddleware(uploadLimiter), handleRejob)
+	api.POST("/preview-command", handlePreviewCommand)
+	api.GET("/status/:jobID", handleStatus)
+	api.POST("/status/batch", handleStatusBatch)
+	api.GET("/batch/:batchID", handleBatch)
+	api.GET("/events/:jobID", handleEvents)
+	api.GET("/stream/:jobID", handleStream)
+	api.GET("/logs/:jobID", handleLogs)
+	api.DELETE("/job/:jobID", handleCancel)
+	router.GET("/jobs", adminAuthMiddleware(), handleListJobs)
+	router.POST("/jobs/delete", adminAuthMiddleware(), handleBulkDelete)
 
 	if _, err := os.Stat(frontendDir); err == nil {
 		router.Static("/assets", filepath.Join(frontendDir, "assets"))
@@ -106,66 +405,354 @@ func main() {
 	}
 
 	port := "8080"
-	fmt.Printf(" Server starting on http://localhost:%s\n", port)
-	fmt.Printf(" Upload directory: %s\n", uploadDir)
-	fmt.Printf(" Static directory: %s\n", staticDir)
-	fmt.Println(" Ready to accept file uploads at POST /upload")
-	fmt.Println(" Status endpoint available at GET /status/:jobID")
-	fmt.Println(" Compressed files served at /static/:filename")
+	slog.Info("Server starting", "event", "startup", "port", port, "uploadDir", uploadDir, "staticDir", staticDir,
+		"maxFileSize", maxFileSize, "maxDurationSeconds", maxDuration,
+		"ffmpeg", ffmpegPath, "ffprobe", ffprobePath)
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
 	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	slog.Info("Shutdown signal received, no longer accepting uploads", "event", "shutdown")
+	shutdown(server, drainTimeout)
 }
 
 func handleUpload(c *gin.Context) {
+	uploadID, ok := trackUpload(c)
+	if !ok {
+		return
+	}
+	defer finishUpload(uploadID)
 
-	file, err := c.FormFile("video")
-	if err != nil {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["video"]) == 0 {
+		details := "no video file in the request"
+		if err != nil {
+			details = err.Error()
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "No file provided",
-			"details": err.Error(),
+			"details": details,
 		})
 		return
 	}
 
-	if file.Size > maxFileSize {
+	files := form.File["video"]
+	if len(files) > maxBatchFiles {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("File too large. Maximum size is %dMB", maxFileSize/(1024*1024)),
+			"error": fmt.Sprintf("Too many files. At most %d can be uploaded at once", maxBatchFiles),
 		})
 		return
 	}
 
-	jobID := uuid.New().String()
+	extensions := make([]string, len(files))
+	for i, file := range files {
+		if file.Size > maxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    fmt.Sprintf("File too large. Maximum size is %dMB", maxFileSize/(1024*1024)),
+				"filename": file.Filename,
+			})
+			return
+		}
+
+		if err := checkFilenameExtension(file.Filename); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    "Invalid file extension",
+				"details":  err.Error(),
+				"filename": file.Filename,
+			})
+			return
+		}
 
-	ext := filepath.Ext(file.Filename)
-	if ext == "" {
-		ext = ".mp4"
+		contentType, err := detectUploadedVideo(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    "Invalid file type",
+				"details":  err.Error(),
+				"filename": file.Filename,
+			})
+			return
+		}
+		extensions[i] = videoExtension(file.Filename, contentType)
 	}
 
-	inputPath := filepath.Join(uploadDir, fmt.Sprintf("%s_input%s", jobID, ext))
-	if err := c.SaveUploadedFile(file, inputPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to save file",
-			"details": err.Error(),
-		})
+	opts, ok := bindCompressionOptions(c)
+	if !ok {
+		return
+	}
+
+	var watermarkData []byte
+	if images := form.File["watermark"]; len(images) > 0 {
+		if opts.animated() || opts.audioOnly() || opts.remux() || opts.hls() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Watermark images require re-encoding and are not supported for gif, webp, audio, remux or hls output",
+			})
+			return
+		}
+		opts.ImageWatermark, watermarkData, err = readImageWatermark(images[0], c.DefaultPostForm("watermarkPosition", "bottom-right"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid watermark image",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	if len(files) == 1 {
+		jobID := uploadID
+		if jobID == "" {
+			jobID = uuid.New().String()
+		}
+		inputPath, inputHash, err := saveUploadedVideo(jobID, files[0], extensions[0])
+		if err == nil && opts.ImageWatermark != nil {
+			err = saveImageWatermark(jobID, opts.ImageWatermark, watermarkData)
+		}
+		if err != nil {
+			discardUpload(jobID, inputPath, opts)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to save file",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(submitUploadedJob(jobID, inputPath, files[0].Filename, files[0].Size, opts, "", inputHash))
 		return
 	}
 
-	log.Printf("File uploaded: Job ID=%s, File=%s (%.2f MB)", jobID, file.Filename, float64(file.Size)/(1024*1024))
+	batchID := uuid.New().String()
+	jobIDs := []string{}
+	jobs := make([]gin.H, 0, len(files))
+	for i, file := range files {
+		jobID := uuid.New().String()
+		inputPath, inputHash, err := saveUploadedVideo(jobID, file, extensions[i])
+		if err == nil && opts.ImageWatermark != nil {
+			err = saveImageWatermark(jobID, opts.ImageWatermark, watermarkData)
+		}
+		if err != nil {
+			discardUpload(jobID, inputPath, opts)
+			jobs = append(jobs, gin.H{
+				"error":    "Failed to save file",
+				"details":  err.Error(),
+				"filename": file.Filename,
+			})
+			continue
+		}
+
+		status, response := submitUploadedJob(jobID, inputPath, file.Filename, file.Size, opts, batchID, inputHash)
+		if status == http.StatusOK {
+			jobIDs = append(jobIDs, jobID)
+		} else {
+			response["filename"] = file.Filename
+		}
+		jobs = append(jobs, response)
+	}
 
-	setJobStatus(jobID, "processing")
+	if len(jobIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "None of the uploaded files could be queued",
+			"jobs":  jobs,
+		})
+		return
+	}
 
-	go compressVideo(jobID, inputPath)
+	slog.Info("Batch queued", "event", "batch_queued", "batchID", batchID, "jobIDs", jobIDs, "files", len(files))
 
 	c.JSON(http.StatusOK, gin.H{
-		"jobID":    jobID,
-		"message":  "File uploaded successfully. Compression started.",
-		"filename": file.Filename,
-		"size":     file.Size,
+		"batchID": batchID,
+		"jobIDs":  jobIDs,
+		"jobs":    jobs,
 	})
 }
 
+func saveUploadedVideo(jobID string, file *multipart.FileHeader, ext string) (string, string, error) {
+	inputPath := filepath.Join(uploadDir, fmt.Sprintf("%s_input%s", jobID, ext))
+	inputHash, err := saveHashedUpload(file, inputPath)
+	if err != nil {
+		return "", "", err
+	}
+	return inputPath, inputHash, nil
+}
+
+// discardUpload removes the files saved for a job that is not queued: the
+// input and, when the upload had one, the watermark image.
+func discardUpload(jobID, inputPath string, opts CompressionOptions) {
+	if inputPath != "" {
+		os.Remove(inputPath)
+	}
+	if opts.ImageWatermark != nil {
+		os.Remove(imageWatermarkPath(jobID, opts.ImageWatermark))
+	}
+}
+
+func queueUploadedJob(c *gin.Context, jobID, inputPath, filename string, size int64, opts CompressionOptions, inputHash string) {
+	c.JSON(submitUploadedJob(jobID, inputPath, filename, size, opts, "", inputHash))
+}
+
+func submitUploadedJob(jobID, inputPath, filename string, size int64, opts CompressionOptions, batchID, inputHash string) (int, gin.H) {
+	// Batches and image watermarks are never deduplicated: batch status is
+	// tracked per job, and the watermark image is not part of the options.
+	if inputHash != "" && batchID == "" && opts.ImageWatermark == nil {
+		if existingID := findDuplicateJob(inputHash, opts); existingID != "" {
+			discardUpload(jobID, inputPath, opts)
+			jobLogger(existingID).Info("Upload matches completed job, skipping compression", "event", "job_deduplicated", "filename", filename)
+			// The existing job finished long ago, so the caller's callback
+			// fires right away with its result.
+			if opts.CallbackURL != "" {
+				go sendJobCallback(existingID, opts.CallbackURL)
+			}
+
+			// The existing job may belong to another submitter, so its label
+			// and callback URL are replaced by the caller's own options.
+			response := jobStatusResponse(existingID, "complete")
+			response["options"] = opts
+			response["deduplicated"] = true
+			response["message"] = "Identical file was already compressed with these options."
+			response["filename"] = filename
+			response["size"] = size
+			return http.StatusOK, response
+		}
+	}
+
+	metrics, err := validateVideoFile(inputPath)
+	if err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Uploaded file is not a valid video",
+			"details": err.Error(),
+		}
+	}
+
+	if err := validateDuration(metrics.Duration); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Video too long",
+			"details": err.Error(),
+		}
+	}
+
+	if err := opts.validateTrim(metrics.Duration); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Invalid trim range",
+			"details": err.Error(),
+		}
+	}
+
+	if _, err := opts.subtitleTrack(metrics.SubtitleTracks); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":          "Invalid subtitle selection",
+			"details":        err.Error(),
+			"subtitleTracks": metrics.SubtitleTracks,
+		}
+	}
+
+	if err := opts.validateTargetFPS(metrics.FrameRate); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Invalid targetFps",
+			"details": err.Error(),
+		}
+	}
+
+	if _, _, err := opts.gopFrames(metrics.FrameRate); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Invalid keyframe interval",
+			"details": err.Error(),
+		}
+	}
+
+	if err := opts.validateAnimated(metrics.Duration); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Clip is too long for animated output",
+			"details": err.Error(),
+		}
+	}
+
+	if err := opts.validateAudioOutput(metrics); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "No audio to extract",
+			"details": err.Error(),
+		}
+	}
+
+	targetSizeWarning, targetBitrate := "", opts.Bitrate
+	if opts.TargetSizeMB > 0 {
+		var bits int64
+		bits, targetSizeWarning, err = opts.targetSizeBitrate(metrics, opts.clipDuration(metrics.Duration), opts.expectedOutputHeight(metrics))
+		if err != nil {
+			discardUpload(jobID, inputPath, opts)
+			return http.StatusBadRequest, gin.H{
+				"error":   "Target size is not achievable",
+				"details": err.Error(),
+			}
+		}
+		targetBitrate = fmt.Sprintf("%dk", bits/1000)
+	}
+	if opts.autoBitrate() {
+		targetBitrate, _ = opts.autoBitrateFor(opts.expectedEncoder(), metrics, opts.expectedOutputHeight(metrics))
+	}
+	if targetBitrate == "" {
+		targetBitrate = settings.videoBitrateFor(opts.expectedOutputHeight(metrics))
+	}
+	if err := opts.validateMaxrate(targetBitrate); err != nil {
+		discardUpload(jobID, inputPath, opts)
+		return http.StatusBadRequest, gin.H{
+			"error":   "Invalid maxrate",
+			"details": err.Error(),
+		}
+	}
+
+	uploadsReceived.Inc()
+	jobLogger(jobID).Info("File uploaded", "event", "job_uploaded", "status", "queued", "filename", filename, "size", size)
+
+	addJob(&Job{
+		ID:        jobID,
+		Options:   opts,
+		Created:   time.Now(),
+		Input:     inputPath,
+		Batch:     batchID,
+		InputHash: inputHash,
+		Filename:  filename,
+	})
+
+	if !enqueueJob(jobID) {
+		discardUpload(jobID, inputPath, opts)
+		deleteJob(jobID)
+		return http.StatusServiceUnavailable, gin.H{
+			"error": "Compression queue is full, try again later",
+		}
+	}
+
+	response := gin.H{
+		"jobID":          jobID,
+		"status":         "queued",
+		"queuePosition":  getQueuePosition(jobID),
+		"message":        "File uploaded successfully. Compression queued.",
+		"subtitleTracks": metrics.SubtitleTracks,
+		"filename":       filename,
+		"size":           size,
+	}
+	if targetSizeWarning != "" {
+		response["warnings"] = []string{targetSizeWarning}
+	}
+	return http.StatusOK, response
+}
+
 func handleStatus(c *gin.Context) {
 	jobID := c.Param("jobID")
 
@@ -177,62 +764,362 @@ func handleStatus(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, jobStatusResponse(jobID, status))
+}
+
+func jobStatusResponse(jobID, status string) gin.H {
 	response := gin.H{
-		"jobID":  jobID,
-		"status": status,
+		"jobID":   jobID,
+		"status":  status,
+		"options": getJobOptions(jobID),
+	}
+
+	created, started, completed := getJobTimes(jobID)
+	response["createdAt"] = created
+	if !started.IsZero() {
+		response["startedAt"] = started
+	}
+	if !completed.IsZero() {
+		response["completedAt"] = completed
+	}
+
+	if getJobOptions(jobID).Fragmented && (status == "processing" || status == "complete") {
+		response["streamURL"] = fmt.Sprintf("/stream/%s", jobID)
+	}
+
+	if status == "uploading" {
+		if upload := getJobUpload(jobID); upload != nil {
+			response["receivedBytes"] = upload.Received()
+			if upload.Total > 0 {
+				response["totalBytes"] = upload.Total
+				response["progress"] = upload.percent()
+			}
+		}
+	}
+
+	if status == "queued" {
+		response["queuePosition"] = getQueuePosition(jobID)
+		response["priority"], response["effectivePriority"] = getJobPriority(jobID)
+	}
+
+	if status == "processing" {
+		if progress := getJobProgress(jobID); progress != nil {
+			response["phase"] = progress.Phase
+			response["phaseProgress"] = progress.PhaseProgress
+			response["progress"] = progress.Overall
+			if progress.ETASeconds != nil {
+				response["etaSeconds"] = *progress.ETASeconds
+			}
+		}
+		if size := partialOutputSize(jobID); size > 0 {
+			response["outputSize"] = size
+		}
+	}
+
+	if status == "failed" {
+		if jobErr := getJobError(jobID); jobErr != nil {
+			response["error"] = jobErr
+		}
 	}
 
 	if status == "complete" {
-		response["downloadURL"] = fmt.Sprintf("/static/%s_output.mp4", jobID)
+		response["downloadURL"] = outputs.URL(outputFilename(jobID, getJobOptions(jobID)))
+		if getJobOptions(jobID).hls() {
+			response["playlistURL"] = response["downloadURL"]
+		}
 
-		metrics := getJobMetrics(jobID)
-		if metrics != nil {
+		if stored := getJobMetrics(jobID); stored != nil {
+			metrics := *stored
+			metrics.ThumbnailURL = outputURL(metrics.ThumbnailURL)
+			metrics.WaveformURL = outputURL(metrics.WaveformURL)
 			response["metrics"] = metrics
+			if metrics.ThumbnailURL != "" {
+				response["thumbnailURL"] = metrics.ThumbnailURL
+			}
 		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	return response
 }
 
-func compressVideo(jobID, inputPath string) {
-	log.Printf("Starting GPU compression for job %s", jobID)
+// partialOutputSize is how much of the output ffmpeg has written so far, or
+// 0 before the encode has created the file.
+func partialOutputSize(jobID string) int64 {
+	opts := getJobOptions(jobID)
+	if opts.hls() {
+		return hlsOutputSize(jobID)
+	}
+	info, err := os.Stat(filepath.Join(staticDir, outputFilename(jobID, opts)))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func compressVideo(jobID, inputPath string, opts CompressionOptions) {
+	logger := jobLogger(jobID)
+	logger.Info("Starting compression", "event", "job_started", "status", "processing")
 	startTime := time.Now()
 
-	outputPath := filepath.Join(staticDir, fmt.Sprintf("%s_output.mp4", jobID))
+	outputPath := filepath.Join(staticDir, outputFilename(jobID, opts))
+
+	ctx, cancel := context.WithCancel(jobContext)
+	setJobCancel(jobID, cancel)
+	defer clearJobCancel(jobID)
+	defer cleanupJobRun(jobID, opts)
+
+	if getJobStatus(jobID) != "processing" {
+		return
+	}
+
+	phases := []string{phaseProbing, phaseEncoding}
+	if opts.MeasureQuality {
+		phases = append(phases, phaseVMAF)
+	}
+	if opts.AudioVisual != "" {
+		phases = append(phases, phaseWaveform)
+	}
+	if !opts.audioOnly() {
+		phases = append(phases, phaseThumbnail)
+	}
+	phases = append(phases, phaseFinalizing)
+	startJobPhases(jobID, phases...)
 
 	originalMetrics, err := getVideoMetrics(inputPath)
 	if err != nil {
-		log.Printf("Failed to get original video metrics for job %s: %v", jobID, err)
-		setJobStatus(jobID, "failed")
+		logger.Error("Failed to get original video metrics", "error", err)
+		failJob(jobID, newJobError(err, nil))
 		return
 	}
 
-	cmd := exec.Command(
-		"ffmpeg",
-		"-y",
-		"-i", inputPath,
-		"-c:v", "h264_nvenc",
-		"-preset", "fast",
-		"-b:v", "2M",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		outputPath,
-	)
+	overlayPath := ""
+	if opts.ImageWatermark != nil {
+		overlayPath = imageWatermarkPath(jobID, opts.ImageWatermark)
+		if _, err := os.Stat(overlayPath); err != nil {
+			logger.Error("Watermark image is missing", "error", err)
+			failJob(jobID, newJobError(fmt.Errorf("watermark image is missing"), nil))
+			return
+		}
+	}
 
-	output, err := cmd.CombinedOutput()
+	plan, err := buildFFmpegArgs(opts, originalMetrics, ffmpegEnv{
+		Input:           inputPath,
+		NormalizedInput: normalizedInputPath(jobID),
+		Output:          outputPath,
+		TextFile:        watermarkTextPath(jobID),
+		Overlay:         overlayPath,
+		GPUAvailable:    gpuAvailable(),
+		ToneMapping:     supportsToneMapping(),
+	})
+	if err != nil {
+		logger.Warn("Rejected compression", "error", err)
+		failJob(jobID, newJobError(err, nil))
+		return
+	}
+	params := plan.Params
+	targetHeight, decision, clipDuration := plan.TargetHeight, plan.Decision, plan.ClipDuration
+	rateControl, bitrate, crf := plan.RateControl, params.Bitrate, params.CRF
+	audioLayout, toneMapReason, normalizeReason := plan.AudioLayout, plan.ToneMapReason, plan.NormalizeReason
+	if decision != "" {
+		logger.Info("Resolution decision", "decision", decision)
+	}
+	if plan.MaxHeightDecision != "" {
+		logger.Info("Applied maxHeight", "decision", plan.MaxHeightDecision)
+	}
+	if opts.ToneMap && toneMapReason == "" && hdrReason(originalMetrics) != "" {
+		logger.Warn("HDR input but ffmpeg lacks zscale, skipping tone mapping", "reason", hdrReason(originalMetrics))
+	}
+	if plan.CPUFallback {
+		logger.Warn("No usable NVENC device, encoding on the CPU", "encoder", params.Encoder)
+	}
+
+	if opts.TextWatermark != nil {
+		if err := writeWatermarkText(jobID, opts.TextWatermark); err != nil {
+			logger.Error("Failed to prepare text watermark", "error", err)
+			failJob(jobID, newJobError(err, nil))
+			return
+		}
+	}
+
+	preparation := []string{phaseProbing}
+	if normalizeReason != "" {
+		preparation = append(preparation, phaseNormalizing)
+	}
+	if plan.LoudnessMeasure != nil {
+		preparation = append(preparation, phaseLoudness)
+	}
+	if len(preparation) > 1 {
+		setJobPhases(jobID, append(preparation, phases[1:]...)...)
+	}
+
+	if normalizeReason != "" {
+		logger.Info("Normalizing non-standard input", "event", "phase", "phase", phaseNormalizing, "reason", normalizeReason)
+		setJobPhase(jobID, phaseNormalizing)
+
+		output, err := normalizeInput(ctx, jobID, plan.Normalize, originalMetrics.Duration)
+		if ctx.Err() != nil {
+			logger.Info("Job was cancelled during normalization", "event", "job_cancelled", "status", "cancelled")
+			return
+		}
+		if err != nil {
+			logger.Error("Input normalization failed", "error", err, "ffmpegOutput", string(output))
+			failJob(jobID, newJobError(err, output))
+			return
+		}
+	}
+
+	audioNormalization, measuredLoudness := "", ""
+	if params.AudioFilter != "" {
+		audioNormalization = audioNormalizationSinglePass
+	}
+	if plan.LoudnessMeasure != nil {
+		setJobPhase(jobID, phaseLoudness)
+
+		output, err := runFFmpegWithProgress(ctx, jobID, plan.LoudnessMeasure, clipDuration, 0)
+		if ctx.Err() != nil {
+			logger.Info("Job was cancelled during loudness measurement", "event", "job_cancelled", "status", "cancelled")
+			return
+		}
+		var measured *loudnessMeasurement
+		if err == nil {
+			measured, err = parseLoudnessMeasurement(output)
+		}
+		if err != nil {
+			logger.Warn("Loudness measurement failed, normalizing in a single pass", "error", err)
+		} else {
+			params.AudioFilter = loudnormFilter(opts.LoudnessTarget, measured)
+			audioNormalization, measuredLoudness = audioNormalizationTwoPass, measured.InputI
+		}
+	}
+
+	if isNVENC(params.Encoder) {
+		params.GPU = assignGPU()
+	}
+	if params.Threads > 0 {
+		logger.Info("Limiting CPU encode", "threads", params.Threads, "niceness", settings.CPUNiceness)
+	}
+
+	var deadline time.Time
+	if opts.Deadline > 0 {
+		deadline = startTime.Add(time.Duration(opts.Deadline) * time.Second)
+	}
+
+	if opts.hls() {
+		if err := os.MkdirAll(hlsDir(jobID), 0755); err != nil {
+			logger.Error("Failed to create HLS directory", "error", err)
+			failJob(jobID, newJobError(err, nil))
+			return
+		}
+	}
+
+	setJobPhase(jobID, phaseEncoding)
+
+	output, deadlineDowngraded, err := runEncodeWithRetry(ctx, jobID, params, clipDuration, startTime, deadline)
+
+	if ctx.Err() != nil {
+		logger.Info("Job was cancelled, removing partial output", "event", "job_cancelled", "status", "cancelled")
+		return
+	}
+
+	if err != nil && isNVENC(params.Encoder) && (nvencUnavailable(output) || nvencBusy(output)) {
+		if nvencUnavailable(output) {
+			markGPUUnavailable()
+			logger.Warn("NVENC is unavailable, retrying on the CPU", "encoder", cpuFallbackEncoder(params.Encoder))
+		} else {
+			logger.Warn("NVENC stayed busy after retries, encoding this job on the CPU", "encoder", cpuFallbackEncoder(params.Encoder))
+		}
+		params.Encoder = cpuFallbackEncoder(params.Encoder)
+		params.TwoPass = params.TwoPass && supportsTwoPass(params.Encoder)
+		params.GPUScaling = false
+		params.Threads = settings.cpuThreadsFor(opts.Threads)
+
+		setJobPhaseProgress(jobID, 0)
+		output, deadlineDowngraded, err = runEncodeWithRetry(ctx, jobID, params, clipDuration, startTime, deadline)
+	}
 
 	if err != nil {
-		log.Printf("GPU compression failed for job %s: %v\nFFmpeg output: %s", jobID, err, string(output))
-		setJobStatus(jobID, "failed")
+		logger.Error("Compression failed", "encoder", params.Encoder, "error", err, "ffmpegOutput", string(output))
+		failJob(jobID, newJobError(err, output))
+		return
+	}
+
+	decodeResolution := fmt.Sprintf("%dx%d", originalMetrics.Width, originalMetrics.Height)
+	if params.GPUScaling {
+		decodeResolution = fmt.Sprintf("%dx%d", scaledWidth(originalMetrics.Width, originalMetrics.Height, targetHeight), targetHeight)
+	}
+
+	var qualityScore *float64
+	qualityMetric := ""
+	if opts.MeasureQuality {
+		setJobPhase(jobID, phaseVMAF)
+		score, metric, err := measureQuality(ctx, jobID, inputPath, outputPath,
+			originalMetrics.Width, originalMetrics.Height, clipDuration, opts.trimInputArgs())
+		if ctx.Err() != nil {
+			logger.Info("Job was cancelled during quality measurement, removing output", "event", "job_cancelled", "status", "cancelled")
+			return
+		}
+		if err != nil {
+			logger.Warn("Failed to measure quality", "metric", metric, "error", err)
+		} else {
+			qualityScore, qualityMetric = &score, metric
+		}
+	}
+
+	waveformURL := ""
+	if opts.AudioVisual != "" && originalMetrics.AudioCodec != "" {
+		setJobPhase(jobID, phaseWaveform)
+		waveformURL, err = generateAudioVisual(jobID, inputPath, opts.AudioVisual)
+		if err != nil {
+			logger.Warn("Failed to generate audio visualization", "audioVisual", opts.AudioVisual, "error", err)
+		}
+	}
+
+	thumbnailURL := ""
+	if !opts.audioOnly() {
+		setJobPhase(jobID, phaseThumbnail)
+		// Re-encoded outputs are written upright, a remux keeps the source
+		// display matrix.
+		outputRotation := 0
+		if opts.remux() {
+			outputRotation = originalMetrics.Rotation
+		}
+		thumbnailURL, err = generateThumbnail(jobID, outputPath, clipDuration, outputRotation)
+		if err != nil {
+			logger.Warn("Failed to generate thumbnail", "error", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		logger.Info("Job was cancelled, removing output", "event", "job_cancelled", "status", "cancelled")
 		return
 	}
 
-	compressedMetrics, err := getVideoMetrics(outputPath)
+	setJobPhase(jobID, phaseFinalizing)
+
+	compressedPath := outputPath
+	if opts.hls() {
+		compressedPath = filepath.Join(hlsDir(jobID), params.Renditions[0].Playlist)
+	}
+	compressedMetrics, err := getVideoMetrics(compressedPath)
+	if err == nil && opts.hls() {
+		compressedMetrics.Size = hlsOutputSize(jobID)
+	}
+	if err != nil && opts.OutputType == outputTypeWebP {
+		compressedMetrics, err = animatedOutputMetrics(outputPath, opts.OutputType)
+	}
 	if err != nil {
-		log.Printf("Failed to get compressed video metrics for job %s: %v", jobID, err)
-		setJobStatus(jobID, "failed")
+		logger.Error("Failed to get compressed video metrics", "error", err)
+		failJob(jobID, newJobError(err, nil))
 		return
 	}
+	if !opts.animated() {
+		if err := checkOutputDuration(clipDuration, compressedMetrics.Duration); err != nil {
+			logger.Error("Output duration does not match the source, removing output", "error", err,
+				"expectedSeconds", clipDuration, "outputSeconds", compressedMetrics.Duration)
+			failJob(jobID, newJobError(err, nil))
+			return
+		}
+	}
 
 	compressionRatio := 0.0
 	if originalMetrics.Size > 0 {
@@ -242,16 +1129,125 @@ func compressVideo(jobID, inputPath string) {
 	processingTime := time.Since(startTime)
 
 	metrics := &ComparisonMetrics{
-		Original:         *originalMetrics,
-		Compressed:       *compressedMetrics,
-		CompressionRatio: fmt.Sprintf("%.2f", compressionRatio),
-		ProcessingTime:   fmt.Sprintf("%.2fs", processingTime.Seconds()),
+		Original:           *originalMetrics,
+		Compressed:         *compressedMetrics,
+		CompressionRatio:   fmt.Sprintf("%.2f", compressionRatio),
+		ProcessingTime:     fmt.Sprintf("%.2fs", processingTime.Seconds()),
+		Lossless:           opts.Lossless,
+		RateControl:        rateControl,
+		TwoPass:            params.TwoPass,
+		QualityScore:       qualityScore,
+		QualityMetric:      qualityMetric,
+		TargetBitrate:      bitrate,
+		BitrateHeuristic:   plan.BitrateHeuristic,
+		TargetSizeMB:       opts.TargetSizeMB,
+		CRF:                crf,
+		Encoder:            params.Encoder,
+		EncoderType:        encoderType(params.Encoder),
+		EncoderThreads:     params.Threads,
+		ResolutionDecision: decision,
+		MaxHeightDecision:  plan.MaxHeightDecision,
+		WaveformURL:        waveformURL,
+		ThumbnailURL:       thumbnailURL,
+		DecodeResolution:   decodeResolution,
+		GPUDecodeScaling:   params.GPUScaling,
+		GPU:                encodeGPU(params),
+		DeadlineDowngraded: deadlineDowngraded,
+		AudioLayout:        audioLayout,
+		Renditions:         params.Renditions,
+		Normalized:         normalizeReason != "",
+		NormalizeReason:    normalizeReason,
+		PixelFormatReason:  plan.PixelFormatReason,
+		AudioNormalization: audioNormalization,
+		MeasuredLoudness:   measuredLoudness,
+		ToneMapped:         toneMapReason != "",
+		ToneMapReason:      toneMapReason,
+	}
+	if audioNormalization != "" {
+		metrics.LoudnessTarget = opts.LoudnessTarget
+	}
+
+	if opts.Deadline > 0 {
+		met := processingTime <= time.Duration(opts.Deadline)*time.Second
+		metrics.DeadlineMet = &met
+		if !met {
+			metrics.Warnings = append(metrics.Warnings, fmt.Sprintf("Job finished after its %ds deadline", opts.Deadline))
+		}
+	}
+
+	if opts.BitrateTimeline {
+		timeline, err := sampleBitrateTimeline(outputPath, compressedMetrics.Duration)
+		if err != nil {
+			logger.Warn("Failed to sample bitrate timeline", "error", err)
+			metrics.Warnings = append(metrics.Warnings, "Failed to sample bitrate timeline")
+		}
+		metrics.BitrateTimeline = timeline
+	}
+
+	if opts.AudioVisual != "" && originalMetrics.AudioCodec == "" {
+		metrics.Warnings = append(metrics.Warnings, fmt.Sprintf("No audio stream found; %s was skipped", opts.AudioVisual))
+	} else if opts.AudioVisual != "" && waveformURL == "" {
+		metrics.Warnings = append(metrics.Warnings, fmt.Sprintf("Failed to generate %s image", opts.AudioVisual))
+	}
+
+	if opts.ToneMap && toneMapReason == "" && hdrReason(originalMetrics) != "" {
+		metrics.Warnings = append(metrics.Warnings, "HDR input was not tone mapped because ffmpeg lacks the zscale filter")
+	}
+
+	if opts.MeasureQuality && qualityScore == nil {
+		metrics.Warnings = append(metrics.Warnings, "Failed to measure output quality")
+	}
+
+	if decision != "" && settings.UpscalePolicy == upscalePolicyWarn {
+		metrics.Warnings = append(metrics.Warnings, decision)
+	}
+
+	if plan.Warning != "" {
+		metrics.Warnings = append(metrics.Warnings, plan.Warning)
+	}
+
+	if opts.Lossless && compressedMetrics.Size > originalMetrics.Size {
+		metrics.Warnings = append(metrics.Warnings,
+			fmt.Sprintf("Lossless output is %.2f%% larger than the input", -compressionRatio))
 	}
-	setJobMetrics(jobID, metrics)
 
-	log.Printf("GPU compression completed successfully for job %s (%.2f%% reduction, %s)",
-		jobID, compressionRatio, processingTime)
-	setJobStatus(jobID, "complete")
+	if err := publishOutputs(ctx, jobID, opts); err != nil {
+		logger.Error("Failed to store outputs", "error", err)
+		failJob(jobID, newJobError(err, nil))
+		return
+	}
+
+	logger.Info("Compression completed", "event", "job_compressed", "encoder", params.Encoder,
+		"reductionPercent", compressionRatio, "durationMs", processingTime.Milliseconds())
+	jobProcessingSeconds.Observe(processingTime.Seconds())
+	completeJob(jobID, metrics)
+}
+
+// cleanupJobRun removes what a run of compressVideo leaves behind, whichever
+// way it returns. The normalized copy and the text watermark always go, the
+// image watermark unless the job is left to resume, and the output with its
+// thumbnail and waveform unless the job completed.
+func cleanupJobRun(jobID string, opts CompressionOptions) {
+	status := getJobStatus(jobID)
+
+	paths := []string{normalizedInputPath(jobID), watermarkTextPath(jobID)}
+	if opts.ImageWatermark != nil && status != "processing" {
+		paths = append(paths, imageWatermarkPath(jobID, opts.ImageWatermark))
+	}
+	if status != "complete" {
+		for _, key := range jobOutputKeys(jobID, opts) {
+			paths = append(paths, filepath.Join(staticDir, key))
+		}
+		if opts.hls() {
+			removeHLSOutput(jobID)
+		}
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			jobLogger(jobID).Warn("Failed to remove job file", "path", path, "error", err)
+		}
+	}
 }
 
 func getVideoMetrics(filePath string) (*VideoMetrics, error) {
@@ -262,7 +1258,7 @@ func getVideoMetrics(filePath string) (*VideoMetrics, error) {
 	}
 
 	cmd := exec.Command(
-		"ffprobe",
+		ffprobePath,
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
@@ -277,15 +1273,26 @@ func getVideoMetrics(filePath string) (*VideoMetrics, error) {
 
 	var probeData struct {
 		Streams []struct {
-			CodecType    string `json:"codec_type"`
-			CodecName    string `json:"codec_name"`
-			Width        int    `json:"width"`
-			Height       int    `json:"height"`
-			RFrameRate   string `json:"r_frame_rate"`
-			AvgFrameRate string `json:"avg_frame_rate"`
-			BitRate      string `json:"bit_rate"`
-			PixFmt       string `json:"pix_fmt"`
-			ColorSpace   string `json:"color_space"`
+			Index          int    `json:"index"`
+			CodecType      string `json:"codec_type"`
+			CodecName      string `json:"codec_name"`
+			Width          int    `json:"width"`
+			Height         int    `json:"height"`
+			RFrameRate     string `json:"r_frame_rate"`
+			AvgFrameRate   string `json:"avg_frame_rate"`
+			BitRate        string `json:"bit_rate"`
+			PixFmt         string `json:"pix_fmt"`
+			ColorSpace     string `json:"color_space"`
+			ColorRange     string `json:"color_range"`
+			ColorTransfer  string `json:"color_transfer"`
+			ColorPrimaries string `json:"color_primaries"`
+			Channels       int    `json:"channels"`
+			Disposition    struct {
+				Default     int `json:"default"`
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+			SideDataList []probeSideData   `json:"side_data_list"`
+			Tags         map[string]string `json:"tags"`
 		} `json:"streams"`
 		Format struct {
 			Duration string            `json:"duration"`
@@ -315,17 +1322,40 @@ func getVideoMetrics(filePath string) (*VideoMetrics, error) {
 		metrics.Metadata[key] = value
 	}
 
+	var audioBitrateTotal int64
+	audioBitrateKnown := true
+
 	for _, stream := range probeData.Streams {
-		if stream.CodecType == "video" {
+		metrics.Streams = append(metrics.Streams, StreamInfo{
+			Index:       stream.Index,
+			Type:        stream.CodecType,
+			Codec:       stream.CodecName,
+			Language:    stream.Tags["language"],
+			AttachedPic: stream.Disposition.AttachedPic == 1,
+		})
+
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 {
 			metrics.Width = stream.Width
 			metrics.Height = stream.Height
 			metrics.VideoCodec = stream.CodecName
 			metrics.PixelFormat = stream.PixFmt
+			metrics.BitDepth = pixelFormatBitDepth(stream.PixFmt)
 			metrics.ColorSpace = stream.ColorSpace
+			metrics.ColorRange = stream.ColorRange
+			metrics.ColorTransfer = stream.ColorTransfer
+			metrics.ColorPrimaries = stream.ColorPrimaries
+
+			// Report what players show: a portrait phone clip stored as
+			// 1920x1080 with a 90 degree display matrix is 1080x1920.
+			metrics.Rotation = probeRotation(stream.SideDataList, stream.Tags)
+			if rotatesDimensions(metrics.Rotation) {
+				metrics.Width, metrics.Height = metrics.Height, metrics.Width
+			}
 
-			if stream.AvgFrameRate != "" {
-				metrics.FrameRate = parseFrameRate(stream.AvgFrameRate)
-			} else if stream.RFrameRate != "" {
+			// avg_frame_rate is 0/0 for streams without timing, r_frame_rate
+			// usually still has the nominal rate then.
+			metrics.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if metrics.FrameRate == "" {
 				metrics.FrameRate = parseFrameRate(stream.RFrameRate)
 			}
 
@@ -333,49 +1363,243 @@ func getVideoMetrics(filePath string) (*VideoMetrics, error) {
 				metrics.VideoBitrate = bitrate
 			}
 		} else if stream.CodecType == "audio" {
-			metrics.AudioCodec = stream.CodecName
-
 			if bitrate, err := strconv.ParseInt(stream.BitRate, 10, 64); err == nil {
-				metrics.AudioBitrate = bitrate
+				audioBitrateTotal += bitrate
+			} else {
+				audioBitrateKnown = false
 			}
+
+			if len(metrics.AudioTracks) == 0 {
+				metrics.AudioCodec = stream.CodecName
+
+				if bitrate, err := strconv.ParseInt(stream.BitRate, 10, 64); err == nil {
+					metrics.AudioBitrate = bitrate
+				}
+			}
+
+			metrics.AudioTracks = append(metrics.AudioTracks, AudioTrack{
+				Index:    len(metrics.AudioTracks),
+				Codec:    stream.CodecName,
+				Language: stream.Tags["language"],
+				Channels: stream.Channels,
+				Default:  stream.Disposition.Default == 1,
+			})
+		} else if stream.CodecType == "subtitle" {
+			metrics.SubtitleTracks = append(metrics.SubtitleTracks, SubtitleTrack{
+				Index:    len(metrics.SubtitleTracks),
+				Codec:    stream.CodecName,
+				Language: stream.Tags["language"],
+				Title:    stream.Tags["title"],
+				Default:  stream.Disposition.Default == 1,
+			})
+		}
+	}
+
+	if metrics.VideoCodec != "" && metrics.VideoBitrate == 0 {
+		if metrics.Bitrate > audioBitrateTotal && audioBitrateKnown {
+			metrics.VideoBitrate = metrics.Bitrate - audioBitrateTotal
+			metrics.Metadata["videoBitrateEstimate"] = "format bitrate minus audio"
+		} else if bitrate, err := estimateVideoBitrate(filePath, metrics.Duration); err == nil {
+			metrics.VideoBitrate = bitrate
+			metrics.Metadata["videoBitrateEstimate"] = "video packet sizes"
 		}
 	}
 
 	return metrics, nil
 }
 
-func parseFrameRate(frameRate string) string {
-	parts := strings.Split(frameRate, "/")
-	if len(parts) == 2 {
-		num, err1 := strconv.ParseFloat(parts[0], 64)
-		den, err2 := strconv.ParseFloat(parts[1], 64)
-		if err1 == nil && err2 == nil && den != 0 {
-			return fmt.Sprintf("%.2f", num/den)
-		}
+func validateVideoFile(filePath string) (*VideoMetrics, error) {
+	metrics, err := getVideoMetrics(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if metrics.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream found")
+	}
+	return metrics, nil
+}
+
+func resolveTargetHeight(requested int, source *VideoMetrics) (int, string, error) {
+	if requested <= 0 || source.Height <= 0 || requested <= source.Height {
+		return requested, "", nil
+	}
+
+	decision := fmt.Sprintf("requested %dp exceeds the %dx%d source", requested, source.Width, source.Height)
+
+	switch settings.UpscalePolicy {
+	case upscalePolicyReject:
+		return 0, "", fmt.Errorf("%s; upscaling is not allowed", decision)
+	case upscalePolicyWarn:
+		return requested, decision + "; upscaling adds size without adding detail", nil
+	default:
+		return 0, decision + "; clamped to source resolution", nil
 	}
-	return frameRate
 }
 
-func setJobStatus(jobID, status string) {
+// capTargetHeight applies maxHeight and describes the clamp, which is kept
+// apart from the upscale decision since it is what the client asked for.
+func capTargetHeight(targetHeight, limit int, source *VideoMetrics) (int, string) {
+	height := targetHeight
+	if height <= 0 {
+		height = source.Height
+	}
+	if limit <= 0 || height <= limit {
+		return targetHeight, ""
+	}
+	return limit, fmt.Sprintf("downscaled from %dp to the %dp maxHeight", height, limit)
+}
+
+// nvencSupportsLossless reads the encoder capabilities probed at startup, so
+// validating a request never waits for ffmpeg.
+func nvencSupportsLossless(codec string) bool {
+	ffmpegBuildInfo()
+	return isNVENC(codec) && losslessEncoders[codec]
+}
+
+func addJob(job *Job) {
 	jobMutex.Lock()
 	defer jobMutex.Unlock()
-	jobStatus[jobID] = status
+	jobsByID[job.ID] = job
 }
 
 func getJobStatus(jobID string) string {
 	jobMutex.RLock()
 	defer jobMutex.RUnlock()
-	return jobStatus[jobID]
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Status
+	}
+	return ""
 }
 
-func setJobMetrics(jobID string, metrics *ComparisonMetrics) {
+func completeJob(jobID string, metrics *ComparisonMetrics) {
 	jobMutex.Lock()
 	defer jobMutex.Unlock()
-	jobMetrics[jobID] = metrics
+	job, ok := jobsByID[jobID]
+	if !ok || job.Status != "processing" {
+		return
+	}
+	job.Completed = time.Now()
+	metrics.CreatedAt, metrics.StartedAt, metrics.CompletedAt = job.Created, job.Started, job.Completed
+	metrics.Diff = metricsDiff(metrics.Original, metrics.Compressed)
+	job.Metrics = metrics
+	job.Status = "complete"
+	job.Progress = nil
+	jobLogger(jobID).Info("Job completed", "event", "job_completed", "status", job.Status,
+		"durationMs", job.Completed.Sub(job.Started).Milliseconds())
+	indexJobHashLocked(job)
+	jobsProcessing.Dec()
+	jobsCompleted.Inc()
+	recordCompletedStats(metrics, job.Completed.Sub(job.Started))
+	persistJobLocked(jobID)
+	notifyJobLocked(jobID)
+	notifyJobFinishedLocked(job)
+	if callbackURL := job.Options.CallbackURL; callbackURL != "" {
+		go sendJobCallback(jobID, callbackURL)
+	}
+}
+
+func failJob(jobID string, jobErr *JobError) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	job, ok := jobsByID[jobID]
+	if !ok || job.Status != "processing" {
+		return
+	}
+	if job.Progress != nil {
+		jobErr.Phase = job.Progress.Phase
+	}
+	job.Error = jobErr
+	job.Status = "failed"
+	job.Completed = time.Now()
+	job.Progress = nil
+	jobLogger(jobID).Error("Job failed", "event", "job_failed", "status", job.Status, "phase", jobErr.Phase,
+		"error", jobErr.Message, "durationMs", job.Completed.Sub(job.Started).Milliseconds())
+	jobsProcessing.Dec()
+	jobsFailed.Inc()
+	recordFailedStats()
+	persistJobLocked(jobID)
+	notifyJobLocked(jobID)
+	notifyJobFinishedLocked(job)
+	if callbackURL := job.Options.CallbackURL; callbackURL != "" {
+		go sendJobCallback(jobID, callbackURL)
+	}
+}
+
+func getJobError(jobID string) *JobError {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Error
+	}
+	return nil
 }
 
 func getJobMetrics(jobID string) *ComparisonMetrics {
 	jobMutex.RLock()
 	defer jobMutex.RUnlock()
-	return jobMetrics[jobID]
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Metrics
+	}
+	return nil
+}
+
+func getJobTimes(jobID string) (created, started, completed time.Time) {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Created, job.Started, job.Completed
+	}
+	return
+}
+
+func getJobOptions(jobID string) CompressionOptions {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Options
+	}
+	return CompressionOptions{}
+}
+
+func setJobCancel(jobID string, cancel context.CancelFunc) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok {
+		job.cancel = cancel
+	}
+}
+
+func clearJobCancel(jobID string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok && job.cancel != nil {
+		job.cancel()
+		job.cancel = nil
+	}
+}
+
+func cancelJob(jobID string) (string, bool) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	job, ok := jobsByID[jobID]
+	if !ok {
+		return "", false
+	}
+	status := job.Status
+	if status != "processing" && status != "queued" {
+		return status, false
+	}
+	removeFromQueueLocked(jobID)
+	if status == "processing" {
+		jobsProcessing.Dec()
+	}
+	job.Status = "cancelled"
+	job.Completed = time.Now()
+	job.Progress = nil
+	persistJobLocked(jobID)
+	notifyJobLocked(jobID)
+	if job.cancel != nil {
+		job.cancel()
+	}
+	return status, true
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusReadsDuringCompletionAlwaysSeeMetrics(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	const jobs = 50
+	for i := range jobs {
+		jobID := fmt.Sprintf("race-%d", i)
+		addJob(&Job{ID: jobID, Status: "processing", Created: time.Now(), Started: time.Now()})
+		jobsProcessing.Inc()
+		t.Cleanup(func() { deleteJob(jobID) })
+
+		var readers sync.WaitGroup
+		stop := make(chan struct{})
+		for range 4 {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					status := getJobStatus(jobID)
+					response := jobStatusResponse(jobID, status)
+					if status == "complete" && response["metrics"] == nil {
+						t.Errorf("%s: status is complete but metrics are missing", jobID)
+						return
+					}
+					if _, err := json.Marshal(response); err != nil {
+						t.Errorf("%s: failed to encode status: %v", jobID, err)
+						return
+					}
+				}
+			}()
+		}
+
+		completeJob(jobID, &ComparisonMetrics{
+			Original:         VideoMetrics{Size: 2000},
+			Compressed:       VideoMetrics{Size: 1000},
+			CompressionRatio: "50.00",
+		})
+		close(stop)
+		readers.Wait()
+
+		if response := jobStatusResponse(jobID, getJobStatus(jobID)); response["metrics"] == nil {
+			t.Fatalf("%s: completed job has no metrics", jobID)
+		}
+	}
+}
+
+func TestCompletedJobStoresMetricsDiff(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	addJob(&Job{ID: "diff", Status: "processing", Created: time.Now(), Started: time.Now()})
+	jobsProcessing.Inc()
+	t.Cleanup(func() { deleteJob("diff") })
+
+	completeJob("diff", &ComparisonMetrics{
+		Original:   VideoMetrics{Size: 2000, Bitrate: 4000},
+		Compressed: VideoMetrics{Size: 500, Bitrate: 1000},
+	})
+
+	metrics := getJobMetrics("diff")
+	if metrics == nil || metrics.Diff == nil {
+		t.Fatalf("stored metrics = %+v, want a diff", metrics)
+	}
+	if metrics.Diff.SizeReduction != 1500 || metrics.Diff.BitrateReduction != 3000 {
+		t.Errorf("diff = %+v, want sizeReduction 1500 and bitrateReduction 3000", *metrics.Diff)
+	}
+}
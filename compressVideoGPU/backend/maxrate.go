@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func (o CompressionOptions) validateMaxrate(bitrate string) error {
+	if o.Maxrate != "" && bitrate != "" && bitrateBits(o.Maxrate) < bitrateBits(bitrate) {
+		return fmt.Errorf("maxrate %s is below the target bitrate %s", o.Maxrate, bitrate)
+	}
+	return nil
+}
+
+// rateCapArgs caps the VBR peaks of a bitrate encode. Without an explicit
+// bufsize the buffer holds two seconds at maxrate, the same ratio the HLS
+// ladder uses.
+func rateCapArgs(maxrate, bufsize string) []string {
+	if maxrate == "" {
+		return nil
+	}
+	if bufsize == "" {
+		bufsize = strconv.FormatInt(bitrateBits(maxrate)*2, 10)
+	}
+	return []string{"-maxrate", maxrate, "-bufsize", bufsize}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	uploadsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gpuscale_uploads_received_total",
+		Help: "Uploaded videos accepted for compression.",
+	})
+	jobsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gpuscale_jobs_completed_total",
+		Help: "Compression jobs that completed successfully.",
+	})
+	jobsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gpuscale_jobs_failed_total",
+		Help: "Compression jobs that failed.",
+	})
+	jobsProcessing = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpuscale_jobs_processing",
+		Help: "Compression jobs currently being processed.",
+	})
+	jobProcessingSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gpuscale_job_processing_seconds",
+		Help:    "Time taken to process completed compression jobs.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(uploadsReceived, jobsCompleted, jobsFailed, jobsProcessing, jobProcessingSeconds)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	standardPixelFormats = []string{"yuv420p", "nv12"}
+	standardColorSpaces  = []string{"", "unknown", "bt709", "bt470bg", "smpte170m"}
+	standardColorRanges  = []string{"", "unknown", "tv"}
+
+	// High bit depth and HDR sources may keep these as they are: the
+	// intermediate stays 10-bit and carries the source color signalling.
+	highPrecisionPixelFormats = []string{"yuv420p10le", "p010le"}
+	wideGamutColorSpaces      = []string{"bt2020nc", "bt2020c"}
+
+	// Safari and QuickTime refuse H.264/HEVC in these layouts, which NVENC
+	// otherwise carries over from the source.
+	incompatiblePixelFormats = []string{
+		"yuv422p", "yuv444p", "yuvj422p", "yuvj444p",
+		"yuv420p10le", "yuv422p10le", "yuv444p10le", "p010le",
+		"yuv420p12le", "yuv422p12le", "yuv444p12le",
+		"gbrp", "gbrp10le", "rgb24", "bgr24", "bgr0", "rgba",
+	}
+)
+
+func normalizationReason(metrics *VideoMetrics) string {
+	highPrecision := keepsSourcePrecision(metrics)
+	var reasons []string
+	if !slices.Contains(standardPixelFormats, metrics.PixelFormat) &&
+		!(highPrecision && slices.Contains(highPrecisionPixelFormats, metrics.PixelFormat)) {
+		reasons = append(reasons, fmt.Sprintf("pixel format %s", metrics.PixelFormat))
+	}
+	if !slices.Contains(standardColorSpaces, metrics.ColorSpace) &&
+		!(highPrecision && slices.Contains(wideGamutColorSpaces, metrics.ColorSpace)) {
+		reasons = append(reasons, fmt.Sprintf("color matrix %s", metrics.ColorSpace))
+	}
+	if !slices.Contains(standardColorRanges, metrics.ColorRange) {
+		reasons = append(reasons, fmt.Sprintf("color range %s", metrics.ColorRange))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// keepsSourcePrecision reports whether the source is 10-bit or HDR, which
+// normalization must not flatten to 8-bit bt709.
+func keepsSourcePrecision(metrics *VideoMetrics) bool {
+	return pixelFormatBitDepth(metrics.PixelFormat) > 8 || hdrReason(metrics) != ""
+}
+
+// normalizedPixelFormat is the pixel format of the intermediate written by
+// normalizeArgs.
+func normalizedPixelFormat(source *VideoMetrics, bitDepth int) string {
+	if bitDepth == highBitDepth || keepsSourcePrecision(source) {
+		return "yuv420p10le"
+	}
+	return "yuv420p"
+}
+
+// compatiblePixelFormatReason returns why the output has to be forced to
+// 8-bit yuv420p, or "" when the source already plays everywhere.
+func compatiblePixelFormatReason(pixelFormat string) string {
+	if !slices.Contains(incompatiblePixelFormats, pixelFormat) {
+		return ""
+	}
+	return fmt.Sprintf("source pixel format %s does not play in Safari/QuickTime", pixelFormat)
+}
+
+func normalizedInputPath(jobID string) string {
+	return filepath.Join(uploadDir, fmt.Sprintf("%s_normalized.mkv", jobID))
+}
+
+// normalizeArgs converts the selected video stream to 4:2:0 in the TV range.
+// SDR 8-bit sources are converted to bt709. A 10-bit encode gets a 10-bit
+// intermediate, and 10-bit or HDR sources keep their matrix, primaries and
+// transfer so the encoder sees the source signal unchanged.
+func normalizeArgs(inputPath, normalizedPath string, videoStream int, source *VideoMetrics, bitDepth int) []string {
+	args := []string{
+		"-y",
+		"-i", inputPath,
+		"-map", fmt.Sprintf("0:v:%d", videoStream),
+		"-map", "0:a?",
+		"-map", "0:s?",
+	}
+
+	pixFmt := normalizedPixelFormat(source, bitDepth)
+	if keepsSourcePrecision(source) {
+		args = append(args, "-vf", "scale=out_range=tv,format="+pixFmt)
+		for _, tag := range [][2]string{
+			{"-color_primaries", source.ColorPrimaries},
+			{"-color_trc", source.ColorTransfer},
+			{"-colorspace", source.ColorSpace},
+		} {
+			if tag[1] != "" && tag[1] != "unknown" {
+				args = append(args, tag[0], tag[1])
+			}
+		}
+	} else {
+		args = append(args,
+			"-vf", "scale=out_color_matrix=bt709:out_range=tv,format="+pixFmt,
+			"-color_primaries", "bt709",
+			"-color_trc", "bt709",
+			"-colorspace", "bt709",
+		)
+	}
+
+	args = append(args,
+		"-color_range", "tv",
+		"-c:v", "ffv1",
+		"-c:a", "copy",
+		"-c:s", "copy",
+	)
+	// Matroska cannot hold the mov_text subtitles of MP4 sources; they are
+	// converted to SubRip, every other track is copied.
+	for _, track := range source.SubtitleTracks {
+		if codec, err := containerSubtitleCodec("mkv", track); err == nil && codec != "copy" {
+			args = append(args, fmt.Sprintf("-c:s:%d", track.Index), codec)
+		}
+	}
+	return append(args, normalizedPath)
+}
+
+func normalizeInput(ctx context.Context, jobID string, args []string, duration float64) ([]byte, error) {
+	return runFFmpegWithProgress(ctx, jobID, args, duration, 0)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func hdrSource(pixelFormat string) *VideoMetrics {
+	return &VideoMetrics{
+		Width:          3840,
+		Height:         2160,
+		Duration:       10,
+		VideoCodec:     "hevc",
+		FrameRate:      "30",
+		PixelFormat:    pixelFormat,
+		ColorSpace:     "bt2020nc",
+		ColorTransfer:  "smpte2084",
+		ColorPrimaries: "bt2020",
+	}
+}
+
+func TestNormalizationReasonPassesHDRThrough(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *VideoMetrics
+		want   string
+	}{
+		{"hdr10", hdrSource("yuv420p10le"), ""},
+		{"hdr10 p010", hdrSource("p010le"), ""},
+		{"hdr 4:2:2", hdrSource("yuv422p10le"), "pixel format yuv422p10le"},
+		{"sdr 10-bit bt2020", &VideoMetrics{PixelFormat: "yuv420p10le", ColorSpace: "bt2020nc"}, ""},
+		{"sdr 8-bit bt2020", &VideoMetrics{PixelFormat: "yuv420p", ColorSpace: "bt2020nc"}, "color matrix bt2020nc"},
+		{"sdr 8-bit 4:2:2", &VideoMetrics{PixelFormat: "yuv422p", ColorSpace: "bt709"}, "pixel format yuv422p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizationReason(tt.source); got != tt.want {
+				t.Errorf("normalizationReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeArgsKeepsHDRSignalling(t *testing.T) {
+	args := normalizeArgs("in.mov", "out.mkv", 0, hdrSource("yuv422p10le"), 0)
+	joined := strings.Join(args, " ")
+
+	if filter := args[slices.Index(args, "-vf")+1]; filter != "scale=out_range=tv,format=yuv420p10le" {
+		t.Errorf("filter = %q, want a 10-bit conversion that keeps the matrix", filter)
+	}
+	for _, want := range []string{"-color_primaries bt2020", "-color_trc smpte2084", "-colorspace bt2020nc"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args %q do not keep %q", joined, want)
+		}
+	}
+	if strings.Contains(joined, "bt709") {
+		t.Errorf("args %q convert HDR input to bt709", joined)
+	}
+}
+
+func TestNormalizeArgsConvertsSDRToBT709(t *testing.T) {
+	args := normalizeArgs("in.mov", "out.mkv", 0, &VideoMetrics{PixelFormat: "yuv422p", ColorSpace: "bt2020nc"}, 0)
+
+	if filter := args[slices.Index(args, "-vf")+1]; filter != "scale=out_color_matrix=bt709:out_range=tv,format=yuv420p" {
+		t.Errorf("filter = %q, want an 8-bit bt709 conversion", filter)
+	}
+}
+
+func TestBuildFFmpegArgsForcesEightBitOutputFromTenBitIntermediate(t *testing.T) {
+	opts := CompressionOptions{Codec: "h264_nvenc"}
+
+	plan, err := buildFFmpegArgs(opts, hdrSource("yuv422p10le"), testEnv())
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+	if plan.NormalizeReason == "" {
+		t.Fatal("4:2:2 source was not normalized")
+	}
+	if plan.Params.PixelFormat != "yuv420p" {
+		t.Errorf("pixel format = %q, want yuv420p for an 8-bit H.264 encode", plan.Params.PixelFormat)
+	}
+}
+
+func TestNormalizeArgsConvertsMovTextSubtitles(t *testing.T) {
+	source := &VideoMetrics{
+		PixelFormat: "yuv422p",
+		ColorSpace:  "bt709",
+		SubtitleTracks: []SubtitleTrack{
+			{Index: 0, Codec: "mov_text", Language: "eng"},
+			{Index: 1, Codec: "subrip", Language: "fra"},
+			{Index: 2, Codec: "mov_text", Language: "deu"},
+		},
+	}
+
+	args := normalizeArgs("phone.mp4", "out.mkv", 0, source, 0)
+	joined := strings.Join(args, " ")
+
+	for _, want := range []string{"-map 0:s?", "-c:s copy -c:s:0 srt -c:s:2 srt out.mkv"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args %q do not contain %q", joined, want)
+		}
+	}
+	if strings.Contains(joined, "-c:s:1") {
+		t.Errorf("args %q convert a subtitle track mkv can hold", joined)
+	}
+}
+
+func TestNormalizeArgsWithoutSubtitles(t *testing.T) {
+	args := normalizeArgs("in.mov", "out.mkv", 1, &VideoMetrics{PixelFormat: "yuv422p"}, 0)
+
+	if got := args[len(args)-1]; got != "out.mkv" {
+		t.Errorf("last argument = %q, want the output path", got)
+	}
+	if !slices.Contains(args, "0:v:1") {
+		t.Errorf("args %q do not map the selected video stream", args)
+	}
+	if slices.ContainsFunc(args, func(arg string) bool { return strings.HasPrefix(arg, "-c:s:") }) {
+		t.Errorf("args %q set per-track subtitle codecs without subtitles", args)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const notificationQueueSize = 100
+
+// The notifier URLs come from the server configuration, not from users, so
+// unlike callbacks they may point at internal hosts.
+var notifyClient = &http.Client{Timeout: webhookTimeout}
+
+// jobNotification is the summary server-level notifiers send when a job
+// completes or fails.
+type jobNotification struct {
+	JobID            string `json:"jobID"`
+	Status           string `json:"status"`
+	Filename         string `json:"filename,omitempty"`
+	Label            string `json:"label,omitempty"`
+	CompressionRatio string `json:"compressionRatio,omitempty"`
+	ProcessingTime   string `json:"processingTime,omitempty"`
+	DownloadURL      string `json:"downloadURL,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+func (n jobNotification) text() string {
+	name := n.JobID
+	if n.Filename != "" {
+		name = fmt.Sprintf("%s (%s)", n.JobID, n.Filename)
+	}
+	if n.Status == "failed" {
+		return fmt.Sprintf("Job %s failed: %s", name, n.Error)
+	}
+	if size := n.sizeChange(); size != "" {
+		return fmt.Sprintf("Job %s completed in %s, %s: %s", name, n.ProcessingTime, size, n.DownloadURL)
+	}
+	return fmt.Sprintf("Job %s completed in %s: %s", name, n.ProcessingTime, n.DownloadURL)
+}
+
+// sizeChange words the compression ratio by its sign, since a remux can come
+// out larger than the source.
+func (n jobNotification) sizeChange() string {
+	ratio, err := strconv.ParseFloat(n.CompressionRatio, 64)
+	switch {
+	case err != nil:
+		return ""
+	case ratio > 0:
+		return fmt.Sprintf("%.2f%% smaller", ratio)
+	case ratio < 0:
+		return fmt.Sprintf("%.2f%% larger", -ratio)
+	default:
+		return "same size"
+	}
+}
+
+type notifier interface {
+	Name() string
+	Notify(n jobNotification) error
+}
+
+// notifierQueue delivers to one notifier from its own goroutine, so a slow or
+// failing notifier neither blocks the job transition nor the other notifiers.
+type notifierQueue struct {
+	notifier notifier
+	pending  chan jobNotification
+}
+
+var notifiers []*notifierQueue
+
+// loadNotifiers reads NOTIFY_SLACK_WEBHOOK_URL and NOTIFY_EMAIL_TO with its
+// SMTP settings; every notifier that is configured receives each summary.
+func loadNotifiers() ([]notifier, error) {
+	var configured []notifier
+	if url := os.Getenv("NOTIFY_SLACK_WEBHOOK_URL"); url != "" {
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("invalid NOTIFY_SLACK_WEBHOOK_URL %q: must be an http(s) URL", url)
+		}
+		configured = append(configured, slackNotifier{url: url})
+	}
+	if to := os.Getenv("NOTIFY_EMAIL_TO"); to != "" {
+		email := emailNotifier{
+			addr:     os.Getenv("SMTP_ADDR"),
+			from:     os.Getenv("SMTP_FROM"),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+		}
+		for _, recipient := range strings.Split(to, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				email.to = append(email.to, recipient)
+			}
+		}
+		if email.addr == "" || email.from == "" || len(email.to) == 0 {
+			return nil, fmt.Errorf("NOTIFY_EMAIL_TO requires SMTP_ADDR (host:port) and SMTP_FROM")
+		}
+		configured = append(configured, email)
+	}
+	return configured, nil
+}
+
+func startNotifiers(configured []notifier) {
+	for _, n := range configured {
+		queue := &notifierQueue{notifier: n, pending: make(chan jobNotification, notificationQueueSize)}
+		notifiers = append(notifiers, queue)
+		go queue.run()
+	}
+}
+
+func (q *notifierQueue) run() {
+	for notification := range q.pending {
+		q.deliver(notification)
+	}
+}
+
+func (q *notifierQueue) deliver(notification jobNotification) {
+	logger := jobLogger(notification.JobID).With("notifier", q.notifier.Name())
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Notifier panicked", "panic", fmt.Sprint(r))
+		}
+	}()
+	if err := q.notifier.Notify(notification); err != nil {
+		logger.Warn("Failed to send notification", "event", "notification_failed", "error", err)
+		return
+	}
+	logger.Debug("Sent notification", "event", "notification_sent")
+}
+
+// notifyJobFinishedLocked queues the summary of a completed or failed job for
+// every notifier without waiting; a full queue drops the notification.
+func notifyJobFinishedLocked(job *Job) {
+	if len(notifiers) == 0 {
+		return
+	}
+	notification := jobNotification{
+		JobID:    job.ID,
+		Status:   job.Status,
+		Filename: job.Filename,
+		Label:    job.Options.Label,
+	}
+	if job.Metrics != nil {
+		notification.CompressionRatio = job.Metrics.CompressionRatio
+		notification.ProcessingTime = job.Metrics.ProcessingTime
+		notification.DownloadURL = outputs.URL(outputFilename(job.ID, job.Options))
+	}
+	if job.Error != nil {
+		notification.Error = job.Error.Message
+	}
+
+	for _, queue := range notifiers {
+		select {
+		case queue.pending <- notification:
+		default:
+			jobLogger(job.ID).Warn("Notification queue is full, dropping notification", "notifier", queue.notifier.Name())
+		}
+	}
+}
+
+// slackNotifier posts to an incoming webhook, which Slack, Mattermost and
+// Discord's Slack-compatible endpoint all accept.
+type slackNotifier struct {
+	url string
+}
+
+func (s slackNotifier) Name() string {
+	return "slack"
+}
+
+func (s slackNotifier) Notify(n jobNotification) error {
+	body, err := json.Marshal(map[string]string{"text": n.text()})
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	addr     string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (e emailNotifier) Name() string {
+	return "email"
+}
+
+func (e emailNotifier) Notify(n jobNotification) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, _ := strings.Cut(e.addr, ":")
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Job %s %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		e.from, strings.Join(e.to, ", "), n.JobID, n.Status, n.text())
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(message))
+}
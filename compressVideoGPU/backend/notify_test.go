@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJobNotificationText(t *testing.T) {
+	tests := []struct {
+		ratio string
+		want  string
+	}{
+		{"42.50", "42.50% smaller"},
+		{"-5.00", "5.00% larger"},
+		{"0.00", "same size"},
+		{"", "completed in 3s: /static/job.mp4"},
+	}
+	for _, tt := range tests {
+		n := jobNotification{JobID: "job", Status: "complete", CompressionRatio: tt.ratio, ProcessingTime: "3s", DownloadURL: "/static/job.mp4"}
+		if text := n.text(); !strings.Contains(text, tt.want) || strings.Contains(text, "-") {
+			t.Errorf("text() with ratio %q = %q, want it to contain %q", tt.ratio, text, tt.want)
+		}
+	}
+}
+
+func TestLoadNotifiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"slack", map[string]string{"NOTIFY_SLACK_WEBHOOK_URL": "https://hooks.example.com/x"}, []string{"slack"}, false},
+		{"slack without scheme", map[string]string{"NOTIFY_SLACK_WEBHOOK_URL": "hooks.example.com/x"}, nil, true},
+		{"email", map[string]string{"NOTIFY_EMAIL_TO": "a@example.com, b@example.com", "SMTP_ADDR": "mail:25", "SMTP_FROM": "gpuscale@example.com"}, []string{"email"}, false},
+		{"email without smtp", map[string]string{"NOTIFY_EMAIL_TO": "a@example.com"}, nil, true},
+		{"both", map[string]string{"NOTIFY_SLACK_WEBHOOK_URL": "https://hooks.example.com/x", "NOTIFY_EMAIL_TO": "a@example.com", "SMTP_ADDR": "mail:25", "SMTP_FROM": "gpuscale@example.com"}, []string{"slack", "email"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"NOTIFY_SLACK_WEBHOOK_URL", "NOTIFY_EMAIL_TO", "SMTP_ADDR", "SMTP_FROM", "SMTP_USERNAME", "SMTP_PASSWORD"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			configured, err := loadNotifiers()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadNotifiers() error = %v, want error %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, n := range configured {
+				names = append(names, n.Name())
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("loadNotifiers() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+type fakeNotifier struct{}
+
+func (fakeNotifier) Name() string                   { return "fake" }
+func (fakeNotifier) Notify(n jobNotification) error { return nil }
+
+func TestNotifyJobFinishedDropsWhenQueueIsFull(t *testing.T) {
+	queue := &notifierQueue{notifier: fakeNotifier{}, pending: make(chan jobNotification, 2)}
+	previous := notifiers
+	notifiers = []*notifierQueue{queue}
+	t.Cleanup(func() { notifiers = previous })
+
+	// Nothing drains the queue, so the third notification must be dropped
+	// instead of blocking the job transition.
+	for _, jobID := range []string{"first", "second", "third"} {
+		notifyJobFinishedLocked(&Job{ID: jobID, Status: "failed", Error: &JobError{Message: "boom"}})
+	}
+
+	if len(queue.pending) != 2 {
+		t.Fatalf("queued %d notifications, want 2", len(queue.pending))
+	}
+	for _, want := range []string{"first", "second"} {
+		if got := <-queue.pending; got.JobID != want {
+			t.Errorf("queued notification for %s, want %s", got.JobID, want)
+		}
+	}
+}
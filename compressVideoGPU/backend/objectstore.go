@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPresignTTL = time.Hour
+	maxPresignTTL     = 7 * 24 * time.Hour
+	s3RequestTimeout  = 10 * time.Minute
+	unsignedPayload   = "UNSIGNED-PAYLOAD"
+	emptyPayloadHash  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// outputStore holds the finished files of a job under their static filename.
+// Save moves the local file at path into the store, URL returns the address
+// clients download the key from.
+type outputStore interface {
+	Save(ctx context.Context, key, path string) error
+	URL(key string) string
+	Delete(ctx context.Context, key string) error
+}
+
+var outputs outputStore = localStore{}
+
+// localStore serves outputs straight from staticDir, where ffmpeg wrote them.
+type localStore struct{}
+
+func (localStore) Save(ctx context.Context, key, path string) error {
+	return nil
+}
+
+func (localStore) URL(key string) string {
+	return "/static/" + key
+}
+
+func (localStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(filepath.Join(staticDir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3Store keeps outputs in an S3-compatible bucket, signing requests with AWS
+// Signature Version 4 and handing out presigned download URLs.
+type s3Store struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	prefix     string
+	accessKey  string
+	secretKey  string
+	pathStyle  bool
+	presignTTL time.Duration
+	client     *http.Client
+}
+
+func loadOutputStore() (outputStore, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		return localStore{}, nil
+	case "s3":
+	default:
+		return nil, fmt.Errorf("invalid STORAGE_BACKEND %q: must be local or s3", backend)
+	}
+
+	store := &s3Store{
+		region:     "us-east-1",
+		bucket:     os.Getenv("S3_BUCKET"),
+		prefix:     strings.Trim(os.Getenv("S3_PREFIX"), "/"),
+		accessKey:  os.Getenv("S3_ACCESS_KEY_ID"),
+		secretKey:  os.Getenv("S3_SECRET_ACCESS_KEY"),
+		pathStyle:  true,
+		presignTTL: defaultPresignTTL,
+		client:     &http.Client{Timeout: s3RequestTimeout},
+	}
+	if store.bucket == "" || store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("STORAGE_BACKEND s3 requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+	}
+	if value := os.Getenv("S3_REGION"); value != "" {
+		store.region = value
+	}
+
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", store.region)
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q: must be an http(s) URL", endpoint)
+	}
+	store.endpoint = parsed
+
+	if value := os.Getenv("S3_PATH_STYLE"); value != "" {
+		store.pathStyle, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PATH_STYLE %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("S3_PRESIGN_TTL"); value != "" {
+		store.presignTTL, err = time.ParseDuration(value)
+		if err != nil || store.presignTTL <= 0 || store.presignTTL > maxPresignTTL {
+			return nil, fmt.Errorf("invalid S3_PRESIGN_TTL %q: must be a duration up to %s", value, maxPresignTTL)
+		}
+	}
+	return store, nil
+}
+
+func (s *s3Store) Save(ctx context.Context, key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := s.request(ctx, http.MethodPut, key, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if contentType := mime.TypeByExtension(filepath.Ext(key)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err := s.do(req, unsignedPayload); err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %v", key, s.bucket, err)
+	}
+
+	file.Close()
+	return os.Remove(path)
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.do(req, emptyPayloadHash); err != nil {
+		return fmt.Errorf("failed to delete %s from bucket %s: %v", key, s.bucket, err)
+	}
+	return nil
+}
+
+func (s *s3Store) URL(key string) string {
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.presignTTL.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(query)
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String()
+}
+
+func (s *s3Store) objectURL(key string) *url.URL {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+
+	u := *s.endpoint
+	objectPath := "/" + key
+	if s.pathStyle {
+		objectPath = "/" + s.bucket + objectPath
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = awsEscapePath(u.Path)
+	return &u
+}
+
+func (s *s3Store) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+}
+
+func (s *s3Store) do(req *http.Request, payloadHash string) error {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	slices.Sort(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signedHeaders, s.signature(now, canonical)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *s3Store) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), s.region)
+}
+
+func (s *s3Store) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hex.EncodeToString(key)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, which
+// is stricter than net/url and what SigV4 expects.
+func awsEscape(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func jobOutputKeys(jobID string, opts CompressionOptions) []string {
+	return []string{
+		outputFilename(jobID, opts),
+		fmt.Sprintf("%s_thumb.jpg", jobID),
+		fmt.Sprintf("%s_waveform.png", jobID),
+	}
+}
+
+// publishOutputs moves the files a finished job left in staticDir into the
+// output store. Artifacts that were never generated are skipped.
+func publishOutputs(ctx context.Context, jobID string, opts CompressionOptions) error {
+	for _, key := range jobOutputKeys(jobID, opts) {
+		path := filepath.Join(staticDir, key)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := outputs.Save(ctx, key, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeJobOutputs(jobID string, opts CompressionOptions) {
+	for _, key := range jobOutputKeys(jobID, opts) {
+		if err := outputs.Delete(context.Background(), key); err != nil {
+			jobLogger(jobID).Warn("Failed to remove output", "key", key, "error", err)
+		}
+	}
+}
+
+// outputURL rewrites a /static path recorded in the job metrics into the
+// address of the same file in the output store.
+func outputURL(staticURL string) string {
+	if key, ok := strings.CutPrefix(staticURL, "/static/"); ok {
+		return outputs.URL(key)
+	}
+	return staticURL
+}
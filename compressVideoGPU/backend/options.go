@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxJSONOptionsSize bounds a JSON request body, which only carries options.
+const maxJSONOptionsSize = 1 << 20
+
+// OptionError describes one rejected form field of a compression request.
+type OptionError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type optionErrors []OptionError
+
+func (e *optionErrors) add(field, format string, args ...any) {
+	*e = append(*e, OptionError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// parseFlag reads an optional boolean field, leaving target untouched when
+// the field is missing or invalid.
+func (e *optionErrors) parseFlag(c *gin.Context, field string, target *bool) {
+	value := c.PostForm(field)
+	if value == "" {
+		return
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		e.add(field, "Invalid %s flag %q: must be true or false", field, value)
+		return
+	}
+	*target = flag
+}
+
+// bindCompressionOptions parses the options of a request and answers it with
+// every validation error at once when any field is rejected.
+func bindCompressionOptions(c *gin.Context) (CompressionOptions, bool) {
+	opts, errs := parseCompressionOptions(c)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid compression options",
+			"errors": errs,
+		})
+		return opts, false
+	}
+	return opts, true
+}
+
+// jsonOptionFields turns the top-level fields of a JSON body into form
+// values, so JSON requests are validated exactly like form requests. Arrays
+// become comma-separated lists, as in forms.
+func jsonOptionFields(c *gin.Context) (url.Values, error) {
+	var body []byte
+	if cached, ok := c.Get(gin.BodyBytesKey); ok {
+		body, _ = cached.([]byte)
+	} else {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxJSONOptionsSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > maxJSONOptionsSize {
+			return nil, fmt.Errorf("body is larger than %dKB", maxJSONOptionsSize/1024)
+		}
+		c.Set(gin.BodyBytesKey, body)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for field, value := range fields {
+		formValue, err := jsonFormValue(value, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s %v", field, err)
+		}
+		values.Set(field, formValue)
+	}
+	return values, nil
+}
+
+func jsonFormValue(value any, allowList bool) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case json.Number:
+		return value.String(), nil
+	case []any:
+		if allowList {
+			items := make([]string, len(value))
+			for i, item := range value {
+				formValue, err := jsonFormValue(item, false)
+				if err != nil {
+					return "", err
+				}
+				items[i] = formValue
+			}
+			return strings.Join(items, ","), nil
+		}
+	}
+	return "", fmt.Errorf("must be a string, number, boolean or a list of them")
+}
+
+// parseCompressionOptions reads the compression fields shared by every way
+// of submitting a job, from form fields or the fields of a JSON body. It
+// keeps going after a rejected field so the caller can report all problems
+// together; fields that fail validation are left at their zero value.
+func parseCompressionOptions(c *gin.Context) (CompressionOptions, []OptionError) {
+	var opts CompressionOptions
+	var errs optionErrors
+
+	if c.ContentType() == binding.MIMEJSON {
+		fields, err := jsonOptionFields(c)
+		if err != nil {
+			errs.add("body", "Invalid JSON body: %v", err)
+			return opts, errs
+		}
+		// Set before gin parses the form, which keeps an existing PostForm.
+		c.Request.PostForm = fields
+	}
+
+	errs.parseFlag(c, "lossless", &opts.Lossless)
+	errs.parseFlag(c, "fragmented", &opts.Fragmented)
+	errs.parseFlag(c, "bitrateTimeline", &opts.BitrateTimeline)
+	errs.parseFlag(c, "twoPass", &opts.TwoPass)
+	errs.parseFlag(c, "tonemap", &opts.ToneMap)
+	errs.parseFlag(c, "measureQuality", &opts.MeasureQuality)
+	errs.parseFlag(c, "audioNormalize", &opts.AudioNormalize)
+	errs.parseFlag(c, "twoPassAudio", &opts.TwoPassAudio)
+	errs.parseFlag(c, "sharpen", &opts.Sharpen)
+	errs.parseFlag(c, "stripMetadata", &opts.StripMetadata)
+
+	if opts.ToneMap && opts.Lossless {
+		errs.add("tonemap", "tonemap cannot be combined with lossless")
+	}
+
+	if value := c.PostForm("deadline"); value != "" {
+		deadline, err := strconv.Atoi(value)
+		if err != nil || deadline <= 0 || deadline > maxDeadlineSeconds {
+			errs.add("deadline", "Invalid deadline %q: must be between 1 and %d seconds", value, maxDeadlineSeconds)
+		} else {
+			opts.Deadline = deadline
+		}
+	}
+
+	if value := c.PostForm("audioTracks"); value != "" {
+		selectors, err := parseAudioTrackSelection(value)
+		if err != nil {
+			errs.add("audioTracks", "Invalid audioTracks selection: %v", err)
+		} else {
+			opts.AudioTracks = selectors
+		}
+	}
+
+	if value := c.PostForm("streams"); value != "" {
+		indices, err := parseStreamSelection(value)
+		switch {
+		case err != nil:
+			errs.add("streams", "Invalid streams selection: %v", err)
+		case len(opts.AudioTracks) > 0:
+			errs.add("streams", "Set either streams or audioTracks, not both")
+		default:
+			opts.Streams = indices
+		}
+	}
+
+	if value := c.PostForm("bitrate"); value != "" {
+		if value != bitrateAuto && !bitratePattern.MatchString(value) {
+			errs.add("bitrate", "Invalid bitrate %q: use auto or a number with an optional k or M suffix, e.g. 4M", value)
+		} else {
+			opts.Bitrate = value
+		}
+	}
+	if value := c.PostForm("qualityTier"); value != "" {
+		if _, ok := qualityTierBitsPerPixel[value]; !ok || !opts.autoBitrate() {
+			errs.add("qualityTier", "Invalid qualityTier %q: must be low, medium or high and requires bitrate auto", value)
+		} else {
+			opts.QualityTier = value
+		}
+	} else if opts.autoBitrate() {
+		opts.QualityTier = defaultQualityTier
+	}
+
+	switch value := c.PostForm("audioMode"); value {
+	case "", audioModeCopy, audioModeStrip, audioModeReencode:
+		opts.AudioMode = value
+	default:
+		errs.add("audioMode", "Invalid audioMode %q: must be copy, strip or reencode", value)
+	}
+
+	if value := c.PostForm("audioCodec"); value != "" {
+		switch {
+		case !slices.Contains(audioCodecs, value):
+			errs.add("audioCodec", "Invalid audioCodec %q: must be one of %s", value, strings.Join(audioCodecs, ", "))
+		case opts.AudioMode == audioModeStrip:
+			errs.add("audioCodec", "audioCodec cannot be combined with audioMode strip")
+		case value == "copy" && opts.AudioMode == audioModeReencode:
+			errs.add("audioCodec", "audioCodec copy cannot be combined with audioMode reencode")
+		case value != "copy" && opts.AudioMode == audioModeCopy:
+			errs.add("audioCodec", "audioCodec %s re-encodes the audio and cannot be combined with audioMode copy", value)
+		default:
+			opts.AudioCodec = value
+		}
+	}
+
+	if value := c.PostForm("audioBitrate"); value != "" {
+		reencode := opts.AudioMode == audioModeReencode || (opts.AudioCodec != "" && opts.AudioCodec != "copy") || c.PostForm("outputType") == outputTypeAudio
+		if !reencode || !bitratePattern.MatchString(value) {
+			errs.add("audioBitrate", "Invalid audioBitrate %q: requires audioMode reencode, audioCodec aac or libopus or outputType audio, and a number with an optional k or M suffix, e.g. 192k", value)
+		} else {
+			opts.AudioBitrate = value
+		}
+	}
+
+	if opts.AudioMode == audioModeStrip && len(opts.AudioTracks) > 0 {
+		errs.add("audioTracks", "audioTracks cannot be combined with audioMode strip")
+	}
+
+	if opts.AudioNormalize {
+		if opts.AudioMode == audioModeCopy || opts.AudioMode == audioModeStrip {
+			errs.add("audioNormalize", "audioNormalize re-encodes the audio and cannot be combined with audioMode %s", opts.AudioMode)
+		} else if opts.AudioCodec == "copy" {
+			errs.add("audioNormalize", "audioNormalize re-encodes the audio and cannot be combined with audioCodec copy")
+		}
+		opts.LoudnessTarget = defaultLoudnessTarget
+	}
+	if opts.TwoPassAudio && (!opts.AudioNormalize || len(opts.AudioTracks) > 1) {
+		errs.add("twoPassAudio", "twoPassAudio requires audioNormalize and at most one audio track, since the measurement is taken from a single track")
+	}
+	if value := c.PostForm("loudnessTarget"); value != "" {
+		target, err := strconv.ParseFloat(value, 64)
+		if err != nil || target < minLoudnessTarget || target > maxLoudnessTarget || !opts.AudioNormalize {
+			errs.add("loudnessTarget", "Invalid loudnessTarget %q: must be between %g and %g LUFS and requires audioNormalize", value, minLoudnessTarget, maxLoudnessTarget)
+		} else {
+			opts.LoudnessTarget = target
+		}
+	}
+
+	if value := c.PostForm("crf"); value != "" {
+		crf, err := strconv.Atoi(value)
+		if err != nil || crf < 0 || crf > 51 {
+			errs.add("crf", "Invalid crf %q: must be an integer between 0 and 51", value)
+		} else {
+			opts.CRF = &crf
+		}
+	}
+
+	if opts.Bitrate != "" && opts.CRF != nil {
+		errs.add("crf", "Set either bitrate or crf, not both")
+	}
+
+	if value := c.PostForm("maxrate"); value != "" {
+		switch {
+		case !bitratePattern.MatchString(value):
+			errs.add("maxrate", "Invalid maxrate %q: use a number with an optional k or M suffix, e.g. 6M", value)
+		case opts.CRF != nil || opts.Lossless:
+			errs.add("maxrate", "maxrate caps bitrate mode only and cannot be combined with crf or lossless")
+		default:
+			opts.Maxrate = value
+			if err := opts.validateMaxrate(opts.Bitrate); err != nil {
+				errs.add("maxrate", "Invalid maxrate: %v", err)
+			}
+		}
+	}
+	if value := c.PostForm("bufsize"); value != "" {
+		switch {
+		case !bitratePattern.MatchString(value):
+			errs.add("bufsize", "Invalid bufsize %q: use a number with an optional k or M suffix, e.g. 12M", value)
+		case opts.CRF != nil || opts.Lossless:
+			errs.add("bufsize", "bufsize applies to bitrate mode only and cannot be combined with crf or lossless")
+		case opts.Maxrate == "":
+			errs.add("bufsize", "bufsize requires maxrate")
+		default:
+			opts.Bufsize = value
+		}
+	}
+
+	if value := c.PostForm("targetSizeMB"); value != "" {
+		size, err := strconv.ParseFloat(value, 64)
+		switch {
+		case err != nil || size <= 0:
+			errs.add("targetSizeMB", "Invalid targetSizeMB %q: must be a positive number of megabytes", value)
+		case opts.Bitrate != "" || opts.CRF != nil || opts.Lossless || opts.Deadline > 0:
+			errs.add("targetSizeMB", "targetSizeMB sets the bitrate and cannot be combined with bitrate, crf, lossless or deadline")
+		default:
+			opts.TargetSizeMB = size
+			opts.TwoPass = true
+		}
+	}
+
+	if opts.TwoPass && (opts.CRF != nil || opts.Lossless || opts.Deadline > 0) {
+		errs.add("twoPass", "twoPass targets a bitrate and cannot be combined with crf, lossless or deadline")
+	}
+
+	if value := c.PostForm("height"); value != "" {
+		height, err := strconv.Atoi(value)
+		if err != nil || height <= 0 || height > maxHeight || height%2 != 0 {
+			errs.add("height", "Invalid height %q: must be an even number between 2 and %d", value, maxHeight)
+		} else {
+			opts.TargetHeight = height
+		}
+	}
+
+	if value := c.PostForm("maxHeight"); value != "" {
+		height, err := strconv.Atoi(strings.TrimSuffix(value, "p"))
+		if err != nil || height <= 0 || height > maxHeight || height%2 != 0 {
+			errs.add("maxHeight", "Invalid maxHeight %q: must be an even number between 2 and %d, or a preset such as 1080p", value, maxHeight)
+		} else {
+			opts.MaxHeight = height
+		}
+	}
+
+	if value := c.PostForm("targetFps"); value != "" {
+		fps, err := strconv.ParseFloat(value, 64)
+		if err != nil || fps < 1 || fps > maxTargetFPS {
+			errs.add("targetFps", "Invalid targetFps %q: must be between 1 and %d", value, maxTargetFPS)
+		} else {
+			opts.TargetFPS = fps
+		}
+	}
+
+	if value := c.PostForm("keyframeInterval"); value != "" {
+		interval, err := strconv.ParseFloat(value, 64)
+		if err != nil || interval <= 0 || interval > maxKeyframeIntervalSeconds {
+			errs.add("keyframeInterval", "Invalid keyframeInterval %q: must be between 0 and %d seconds", value, maxKeyframeIntervalSeconds)
+		} else {
+			opts.KeyframeInterval = interval
+		}
+	}
+
+	if value := c.PostForm("gopSize"); value != "" {
+		gop, err := strconv.Atoi(value)
+		if err != nil || gop < 1 || opts.KeyframeInterval > 0 {
+			errs.add("gopSize", "Invalid gopSize %q: must be a positive number of frames and cannot be combined with keyframeInterval", value)
+		} else {
+			opts.GOPSize = gop
+		}
+	}
+
+	switch value := c.PostForm("denoise"); value {
+	case "":
+	case "true", denoiseHQDN3D:
+		opts.Denoise = denoiseHQDN3D
+	case denoiseNLMeans:
+		opts.Denoise = value
+	default:
+		errs.add("denoise", "Invalid denoise %q: must be hqdn3d or nlmeans", value)
+	}
+	if opts.Denoise != "" {
+		opts.DenoiseStrength = defaultDenoiseStrength(opts.Denoise)
+	}
+	if value := c.PostForm("denoiseStrength"); value != "" {
+		strength, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			err = validateDenoiseStrength(opts.Denoise, strength)
+		}
+		switch {
+		case opts.Denoise == "":
+			errs.add("denoiseStrength", "denoiseStrength requires denoise")
+		case err != nil:
+			errs.add("denoiseStrength", "Invalid denoiseStrength %q: %v", value, err)
+		default:
+			opts.DenoiseStrength = strength
+		}
+	}
+
+	if opts.Sharpen {
+		opts.SharpenStrength = defaultSharpenStrength
+	}
+
+	if value := c.PostForm("sharpenStrength"); value != "" {
+		strength, err := strconv.ParseFloat(value, 64)
+		if err != nil || strength <= 0 || strength > maxSharpenStrength || !opts.Sharpen {
+			errs.add("sharpenStrength", "Invalid sharpenStrength %q: must be between 0 and %g and requires sharpen", value, maxSharpenStrength)
+		} else {
+			opts.SharpenStrength = strength
+		}
+	}
+
+	if value := c.PostForm("videoFilter"); value != "" {
+		if filter, err := parseVideoFilter(value); err != nil {
+			errs.add("videoFilter", "Invalid videoFilter: %v", err)
+		} else {
+			opts.VideoFilter = filter
+		}
+	}
+
+	if value := c.PostForm("threads"); value != "" {
+		threads, err := strconv.Atoi(value)
+		if err != nil || threads <= 0 || threads > runtime.NumCPU() {
+			errs.add("threads", "Invalid threads %q: must be between 1 and %d", value, runtime.NumCPU())
+		} else {
+			opts.Threads = threads
+		}
+	}
+
+	if value := c.PostForm("startTime"); value != "" {
+		start, err := strconv.ParseFloat(value, 64)
+		if err != nil || start < 0 {
+			errs.add("startTime", "Invalid startTime %q: must be a non-negative number of seconds", value)
+		} else {
+			opts.StartTime = start
+		}
+	}
+
+	if c.PostForm("duration") != "" && c.PostForm("endTime") != "" {
+		errs.add("endTime", "Set either duration or endTime, not both")
+	} else if value := c.PostForm("duration"); value != "" {
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil || duration <= 0 {
+			errs.add("duration", "Invalid duration %q: must be a positive number of seconds", value)
+		} else {
+			opts.Duration = duration
+		}
+	} else if value := c.PostForm("endTime"); value != "" {
+		end, err := strconv.ParseFloat(value, 64)
+		if err != nil || end <= opts.StartTime {
+			errs.add("endTime", "Invalid endTime %q: must be a number of seconds after startTime", value)
+		} else {
+			opts.Duration = end - opts.StartTime
+		}
+	}
+
+	opts.Label = c.PostForm("label")
+
+	switch value := c.PostForm("priority"); value {
+	case "", priorityNormal:
+	case priorityHigh, priorityLow:
+		opts.Priority = value
+	default:
+		errs.add("priority", "Invalid priority %q: must be high, normal or low", value)
+	}
+
+	if value := c.PostForm("callbackURL"); value != "" {
+		callback, err := url.Parse(value)
+		if err == nil {
+			err = validateRemoteURL(callback)
+		}
+		switch {
+		case err != nil:
+			errs.add("callbackURL", "Invalid callbackURL: %v", err)
+		case webhookSecret() == "":
+			errs.add("callbackURL", "Callbacks are disabled; set WEBHOOK_SECRET to enable them")
+		default:
+			opts.CallbackURL = value
+		}
+	}
+
+	switch value := c.PostForm("subtitles"); value {
+	case "", subtitleModeBurn, subtitleModeCopy:
+		opts.Subtitles = value
+	default:
+		errs.add("subtitles", "Invalid subtitles %q: must be burn or copy", value)
+	}
+
+	if value := c.PostForm("subtitleTrack"); value != "" {
+		track, err := strconv.Atoi(value)
+		if err != nil || track < 0 || opts.Subtitles == "" {
+			errs.add("subtitleTrack", "Invalid subtitleTrack %q: must be a non-negative track index and requires subtitles burn or copy", value)
+		} else {
+			opts.SubtitleTrack = track
+		}
+	}
+
+	switch value := c.PostForm("audioVisual"); value {
+	case "", audioVisualWaveform, audioVisualSpectrogram:
+		opts.AudioVisual = value
+	default:
+		errs.add("audioVisual", "Invalid audioVisual %q: must be waveform or spectrogram", value)
+	}
+
+	if text := c.PostForm("textWatermark"); text != "" {
+		watermark := &TextWatermark{
+			Text:     text,
+			Position: c.DefaultPostForm("textWatermarkPosition", "bottom-right"),
+			FontSize: defaultTextWatermarkSize,
+			Color:    c.DefaultPostForm("textWatermarkColor", "white"),
+			Opacity:  0.7,
+		}
+
+		var err error
+		if value := c.PostForm("textWatermarkSize"); value != "" {
+			watermark.FontSize, err = strconv.Atoi(value)
+		}
+		if value := c.PostForm("textWatermarkOpacity"); value != "" && err == nil {
+			watermark.Opacity, err = strconv.ParseFloat(value, 64)
+		}
+		if err == nil {
+			err = watermark.validate()
+		}
+
+		switch {
+		case err != nil:
+			errs.add("textWatermark", "Invalid text watermark: %v", err)
+		case !fontAvailable():
+			errs.add("textWatermark", "Text watermarks are unavailable: font file %s not found", fontFile())
+		default:
+			opts.TextWatermark = watermark
+		}
+	}
+
+	opts.Codec = c.DefaultPostForm("codec", settings.VideoCodec)
+	if opts.Codec != settings.VideoCodec && !slices.Contains(uploadCodecs, opts.Codec) {
+		errs.add("codec", "Unsupported codec %q: must be one of %s", opts.Codec, strings.Join(uploadCodecs, ", "))
+	} else if opts.Lossless && !nvencSupportsLossless(opts.Codec) {
+		errs.add("lossless", "Lossless encoding is not supported by %s", opts.Codec)
+	}
+
+	if value := c.PostForm("preset"); value != "" {
+		switch {
+		case !slices.Contains(videoCodecPresets[opts.Codec], value):
+			errs.add("preset", "Invalid preset %q for %s: must be one of %s", value, opts.Codec, strings.Join(videoCodecPresets[opts.Codec], ", "))
+		case opts.Lossless || opts.Deadline > 0:
+			errs.add("preset", "preset cannot be combined with lossless or deadline, which choose their own presets")
+		default:
+			opts.Preset = value
+		}
+	}
+
+	if value := c.PostForm("bitDepth"); value != "" {
+		depth, err := strconv.Atoi(value)
+		switch {
+		case err != nil || (depth != 8 && depth != highBitDepth):
+			errs.add("bitDepth", "Invalid bitDepth %q: must be 8 or 10", value)
+		case depth == highBitDepth && opts.Codec != "hevc_nvenc":
+			errs.add("bitDepth", "bitDepth 10 requires codec hevc_nvenc, %s only encodes 8-bit here", opts.Codec)
+		case depth == highBitDepth && opts.Lossless:
+			errs.add("bitDepth", "bitDepth 10 cannot be combined with lossless, which keeps the source pixel format")
+		case depth == highBitDepth:
+			opts.BitDepth = depth
+		}
+	}
+
+	switch value := c.PostForm("outputType"); value {
+	case "", "video":
+	case outputTypeGIF, outputTypeWebP, outputTypeAudio:
+		opts.OutputType = value
+	default:
+		errs.add("outputType", "Invalid outputType %q: must be video, gif, webp or audio", value)
+	}
+
+	if value := c.PostForm("audioFormat"); value != "" {
+		if _, ok := audioFormats[value]; !ok || !opts.audioOnly() {
+			errs.add("audioFormat", "Invalid audioFormat %q: must be mp3, m4a or opus and requires outputType audio", value)
+		} else {
+			opts.AudioFormat = value
+		}
+	} else if opts.audioOnly() {
+		opts.AudioFormat = defaultAudioFormat
+	}
+
+	switch value := c.PostForm("mode"); value {
+	case "", modeEncode:
+	case modeRemux, modeHLS:
+		opts.Mode = value
+	default:
+		errs.add("mode", "Invalid mode %q: must be encode, remux or hls", value)
+	}
+
+	if opts.StripMetadata && !opts.remux() {
+		errs.add("stripMetadata", "stripMetadata is only available with mode remux")
+	}
+
+	if opts.remux() {
+		if opts.animated() || opts.audioOnly() || opts.Lossless || opts.TwoPass || opts.Deadline > 0 || opts.CRF != nil || opts.Bitrate != "" ||
+			opts.Preset != "" || opts.Maxrate != "" || opts.TargetHeight > 0 || opts.MaxHeight > 0 || opts.TargetFPS > 0 || opts.ToneMap || opts.TextWatermark != nil || opts.Subtitles != "" || opts.keyframeControl() ||
+			opts.Denoise != "" || opts.Sharpen || opts.VideoFilter != "" || opts.BitDepth > 0 || opts.AudioNormalize || opts.AudioMode == audioModeReencode || opts.AudioCodec != "" || len(opts.AudioTracks) > 0 || c.PostForm("codec") != "" {
+			errs.add("mode", "mode remux copies the streams and cannot be combined with encoding, scaling, filter, audio track or watermark options")
+		}
+
+		opts.Container = c.DefaultPostForm("container", defaultContainer)
+		if err := validateContainerName(opts.Container, opts.Fragmented); err != nil {
+			errs.add("container", "Invalid container: %v", err)
+		}
+		return opts, errs
+	}
+
+	if opts.hls() {
+		if opts.animated() || opts.audioOnly() || opts.Lossless || opts.TwoPass || opts.Deadline > 0 || opts.CRF != nil || opts.Bitrate != "" || opts.Maxrate != "" ||
+			opts.TargetSizeMB > 0 || opts.TargetHeight > 0 || opts.BitDepth > 0 || opts.Fragmented || opts.MeasureQuality || opts.BitrateTimeline ||
+			opts.Subtitles == subtitleModeCopy || len(opts.AudioTracks) > 0 || len(opts.Streams) > 0 || opts.AudioMode == audioModeCopy || (opts.AudioCodec != "" && opts.AudioCodec != "aac") || c.PostForm("container") != "" {
+			errs.add("mode", "mode hls encodes its own bitrate ladder and cannot be combined with outputType, lossless, twoPass, deadline, crf, bitrate, maxrate, targetSizeMB, height, container, bitDepth, fragmented, measureQuality, bitrateTimeline, subtitle copy, audioTracks, streams, audioMode copy or an audioCodec other than aac")
+		}
+		if _, local := outputs.(localStore); !local {
+			errs.add("mode", "mode hls needs STORAGE_BACKEND local, since playlists reference their segments by relative path")
+		}
+		return opts, errs
+	}
+
+	if opts.animated() {
+		if opts.Lossless || opts.TwoPass || opts.BitDepth > 0 || opts.Fragmented || opts.MeasureQuality || opts.BitrateTimeline ||
+			opts.Deadline > 0 || opts.CRF != nil || opts.Bitrate != "" || opts.Maxrate != "" || opts.Preset != "" || opts.AudioVisual != "" ||
+			opts.AudioMode != "" || opts.AudioCodec != "" || opts.AudioNormalize || len(opts.AudioTracks) > 0 || len(opts.Streams) > 0 || opts.TargetHeight > 0 || opts.MaxHeight > 0 || opts.TargetFPS > 0 || opts.Subtitles != "" || opts.keyframeControl() ||
+			c.PostForm("container") != "" || c.PostForm("codec") != "" {
+			errs.add("outputType", "outputType %s only accepts fps, width, startTime, duration, endTime, tonemap, denoise, sharpen, videoFilter, textWatermark, threads, label and callbackURL", opts.OutputType)
+		}
+
+		opts.FPS, opts.Width = defaultAnimatedFPS, defaultAnimatedWidth
+		if value := c.PostForm("fps"); value != "" {
+			fps, err := strconv.Atoi(value)
+			if err != nil || fps <= 0 || fps > maxAnimatedFPS {
+				errs.add("fps", "Invalid fps %q: must be between 1 and %d", value, maxAnimatedFPS)
+			} else {
+				opts.FPS = fps
+			}
+		}
+		if value := c.PostForm("width"); value != "" {
+			width, err := strconv.Atoi(value)
+			if err != nil || width < 16 || width > maxAnimatedWidth || width%2 != 0 {
+				errs.add("width", "Invalid width %q: must be an even number between 16 and %d", value, maxAnimatedWidth)
+			} else {
+				opts.Width = width
+			}
+		}
+		return opts, errs
+	}
+
+	if opts.audioOnly() {
+		if opts.Lossless || opts.TwoPass || opts.BitDepth > 0 || opts.Fragmented || opts.MeasureQuality || opts.BitrateTimeline ||
+			opts.Deadline > 0 || opts.CRF != nil || opts.Bitrate != "" || opts.Maxrate != "" || opts.TargetSizeMB > 0 || opts.Preset != "" ||
+			opts.AudioMode != "" || opts.AudioCodec != "" || len(opts.AudioTracks) > 1 || len(opts.Streams) > 0 || opts.TargetHeight > 0 || opts.MaxHeight > 0 || opts.TargetFPS > 0 ||
+			opts.ToneMap || opts.TextWatermark != nil || opts.Subtitles != "" || opts.keyframeControl() || opts.Denoise != "" || opts.Sharpen || opts.VideoFilter != "" ||
+			c.PostForm("container") != "" || c.PostForm("codec") != "" {
+			errs.add("outputType", "outputType audio only accepts audioFormat, audioBitrate, a single audioTracks entry, audioNormalize, twoPassAudio, loudnessTarget, audioVisual, startTime, duration, endTime, label, priority and callbackURL")
+		}
+		return opts, errs
+	}
+
+	opts.Container = c.DefaultPostForm("container", defaultContainer)
+	if err := validateContainer(opts.Container, opts.Codec, opts.Fragmented); err != nil {
+		errs.add("container", "Invalid container: %v", err)
+	} else if opts.Container == "webm" && opts.AudioMode == audioModeCopy {
+		errs.add("audioMode", "audioMode copy is not available for webm, which only accepts Opus or Vorbis audio")
+	} else if err := validateAudioCodec(opts.Container, opts.AudioCodec); err != nil {
+		errs.add("audioCodec", "Invalid audioCodec: %v", err)
+	}
+
+	return opts, errs
+}
+
+func fontAvailable() bool {
+	_, err := os.Stat(fontFile())
+	return err == nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func formContext(form map[string]string) *gin.Context {
+	values := url.Values{}
+	for key, value := range form {
+		values.Set(key, value)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(values.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c
+}
+
+func TestParseCompressionOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       map[string]string
+		wantFields []string
+		check      func(t *testing.T, opts CompressionOptions)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, opts CompressionOptions) {
+				if opts.Codec != settings.VideoCodec || opts.Container != defaultContainer {
+					t.Errorf("codec %q and container %q, want %q and %q", opts.Codec, opts.Container, settings.VideoCodec, defaultContainer)
+				}
+			},
+		},
+		{
+			name:       "every rejected field is reported",
+			form:       map[string]string{"crf": "99", "height": "3", "priority": "urgent"},
+			wantFields: []string{"crf", "height", "priority"},
+		},
+
+		// mode remux returns before the encoding container checks.
+		{
+			name: "remux",
+			form: map[string]string{"mode": "remux", "container": "mkv", "stripMetadata": "true"},
+			check: func(t *testing.T, opts CompressionOptions) {
+				if !opts.remux() || opts.Container != "mkv" || !opts.StripMetadata {
+					t.Errorf("remux options = %+v", opts)
+				}
+			},
+		},
+		{
+			name:       "remux with crf",
+			form:       map[string]string{"mode": "remux", "crf": "23"},
+			wantFields: []string{"mode"},
+		},
+		{
+			name:       "remux with an explicit codec",
+			form:       map[string]string{"mode": "remux", "codec": "h264_nvenc"},
+			wantFields: []string{"mode"},
+		},
+
+		// mode hls returns before any container is chosen.
+		{
+			name: "hls",
+			form: map[string]string{"mode": "hls", "maxHeight": "720p"},
+			check: func(t *testing.T, opts CompressionOptions) {
+				if !opts.hls() || opts.Container != "" || opts.MaxHeight != 720 {
+					t.Errorf("hls options = %+v", opts)
+				}
+			},
+		},
+		{
+			name:       "hls with bitrate",
+			form:       map[string]string{"mode": "hls", "bitrate": "4M"},
+			wantFields: []string{"mode"},
+		},
+		{
+			name:       "hls with opus audio",
+			form:       map[string]string{"mode": "hls", "audioCodec": "libopus"},
+			wantFields: []string{"mode"},
+		},
+
+		// Animated outputs fill in their own fps and width defaults.
+		{
+			name: "gif defaults",
+			form: map[string]string{"outputType": "gif"},
+			check: func(t *testing.T, opts CompressionOptions) {
+				if opts.FPS != defaultAnimatedFPS || opts.Width != defaultAnimatedWidth || opts.Container != "" {
+					t.Errorf("gif options = %+v", opts)
+				}
+			},
+		},
+		{
+			name: "webp with fps and width",
+			form: map[string]string{"outputType": "webp", "fps": "15", "width": "320"},
+			check: func(t *testing.T, opts CompressionOptions) {
+				if opts.FPS != 15 || opts.Width != 320 {
+					t.Errorf("fps %d and width %d, want 15 and 320", opts.FPS, opts.Width)
+				}
+			},
+		},
+		{
+			name:       "gif with bitrate",
+			form:       map[string]string{"outputType": "gif", "bitrate": "4M"},
+			wantFields: []string{"outputType"},
+		},
+		{
+			name:       "gif with odd width",
+			form:       map[string]string{"outputType": "gif", "width": "321"},
+			wantFields: []string{"width"},
+		},
+
+		// Audio extraction defaults the format and rejects video options.
+		{
+			name: "audio",
+			form: map[string]string{"outputType": "audio"},
+			check: func(t *testing.T, opts CompressionOptions) {
+				if opts.AudioFormat != defaultAudioFormat || opts.Container != "" {
+					t.Errorf("audio options = %+v", opts)
+				}
+			},
+		},
+		{
+			name:       "audio with height",
+			form:       map[string]string{"outputType": "audio", "height": "720"},
+			wantFields: []string{"outputType"},
+		},
+		{
+			name:       "audioFormat without outputType audio",
+			form:       map[string]string{"audioFormat": "mp3"},
+			wantFields: []string{"audioFormat"},
+		},
+
+		// Conflicting fields.
+		{
+			name:       "bitrate and crf",
+			form:       map[string]string{"bitrate": "4M", "crf": "23"},
+			wantFields: []string{"crf"},
+		},
+		{
+			name:       "targetSizeMB and bitrate",
+			form:       map[string]string{"targetSizeMB": "10", "bitrate": "4M"},
+			wantFields: []string{"targetSizeMB"},
+		},
+		{
+			name:       "twoPass and crf",
+			form:       map[string]string{"twoPass": "true", "crf": "23"},
+			wantFields: []string{"twoPass"},
+		},
+		{
+			name:       "maxrate and crf",
+			form:       map[string]string{"maxrate": "6M", "crf": "23"},
+			wantFields: []string{"maxrate"},
+		},
+		{
+			name:       "bufsize without maxrate",
+			form:       map[string]string{"bufsize": "12M"},
+			wantFields: []string{"bufsize"},
+		},
+		{
+			name:       "keyframeInterval and gopSize",
+			form:       map[string]string{"keyframeInterval": "2", "gopSize": "60"},
+			wantFields: []string{"gopSize"},
+		},
+		{
+			name:       "duration and endTime",
+			form:       map[string]string{"duration": "5", "endTime": "10"},
+			wantFields: []string{"endTime"},
+		},
+		{
+			name:       "streams and audioTracks",
+			form:       map[string]string{"audioTracks": "0", "streams": "0,1"},
+			wantFields: []string{"streams"},
+		},
+		{
+			name:       "audioMode copy and audioCodec aac",
+			form:       map[string]string{"audioMode": "copy", "audioCodec": "aac"},
+			wantFields: []string{"audioCodec"},
+		},
+		{
+			name:       "audioMode reencode and audioCodec copy",
+			form:       map[string]string{"audioMode": "reencode", "audioCodec": "copy"},
+			wantFields: []string{"audioCodec"},
+		},
+		{
+			name:       "audioNormalize and audioMode copy",
+			form:       map[string]string{"audioNormalize": "true", "audioMode": "copy"},
+			wantFields: []string{"audioNormalize"},
+		},
+		{
+			name:       "sharpenStrength without sharpen",
+			form:       map[string]string{"sharpenStrength": "1"},
+			wantFields: []string{"sharpenStrength"},
+		},
+		{
+			name:       "stripMetadata without remux",
+			form:       map[string]string{"stripMetadata": "true"},
+			wantFields: []string{"stripMetadata"},
+		},
+		{
+			name:       "bitDepth 10 with h264",
+			form:       map[string]string{"codec": "h264_nvenc", "bitDepth": "10"},
+			wantFields: []string{"bitDepth"},
+		},
+		{
+			name:       "webm with audioMode copy",
+			form:       map[string]string{"codec": "av1_nvenc", "container": "webm", "audioMode": "copy"},
+			wantFields: []string{"audioMode"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, errs := parseCompressionOptions(formContext(tt.form))
+
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("rejected fields = %v, want %v (errors: %+v)", fields, tt.wantFields, errs)
+			}
+			if tt.check != nil {
+				tt.check(t, opts)
+			}
+		})
+	}
+}
+
+func TestParseCompressionOptionsFromJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+		check      func(t *testing.T, opts CompressionOptions)
+	}{
+		{
+			name: "fields",
+			body: `{"url":"https://example.com/a.mp4","crf":23,"priority":"high","callbackURL":"https://example.com/hook","audioTracks":[0,"eng"]}`,
+			check: func(t *testing.T, opts CompressionOptions) {
+				if opts.CRF == nil || *opts.CRF != 23 || opts.Priority != priorityHigh || opts.CallbackURL != "https://example.com/hook" || !slices.Equal(opts.AudioTracks, []string{"0", "eng"}) {
+					t.Errorf("json options = %+v", opts)
+				}
+			},
+		},
+		{
+			name:       "conflicts",
+			body:       `{"crf":23,"bitrate":"4M"}`,
+			wantFields: []string{"crf"},
+		},
+		{
+			name:       "object field",
+			body:       `{"crf":{"value":23}}`,
+			wantFields: []string{"body"},
+		},
+		{
+			name:       "malformed",
+			body:       `{"crf":`,
+			wantFields: []string{"body"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEBHOOK_SECRET", "secret")
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/compress-url", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			opts, errs := parseCompressionOptions(c)
+
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("rejected fields = %v, want %v (errors: %+v)", fields, tt.wantFields, errs)
+			}
+			if tt.check != nil {
+				tt.check(t, opts)
+			}
+		})
+	}
+}
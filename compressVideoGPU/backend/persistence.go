@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jobRecordSuffix = "_job.json"
+
+type jobRecord struct {
+	ID        string             `json:"id"`
+	Status    string             `json:"status"`
+	Metrics   *ComparisonMetrics `json:"metrics,omitempty"`
+	Options   CompressionOptions `json:"options"`
+	Created   time.Time          `json:"created"`
+	Started   time.Time          `json:"started"`
+	Completed time.Time          `json:"completed"`
+	Input     string             `json:"input"`
+	Error     *JobError          `json:"error,omitempty"`
+	Batch     string             `json:"batch,omitempty"`
+	Hash      string             `json:"inputHash,omitempty"`
+	Filename  string             `json:"filename,omitempty"`
+	Resumes   int                `json:"resumes,omitempty"`
+}
+
+// pendingRecords holds the latest snapshot of every job whose record has not
+// been written yet. Snapshots are taken under jobMutex and written by
+// flushJobRecords after it is released, so a slow disk never stalls status
+// reads; a newer snapshot replaces an unwritten older one. A nil entry marks a
+// deleted job whose record file is to be removed.
+var (
+	pendingRecords      = make(map[string]*jobRecord)
+	pendingRecordsMutex sync.Mutex
+	recordsPending      = make(chan struct{}, 1)
+
+	// recordWriteMutex serializes flushes, so an older snapshot taken by one
+	// flush is never written over a newer one taken by another.
+	recordWriteMutex sync.Mutex
+)
+
+func jobRecordPath(jobID string) string {
+	return filepath.Join(uploadDir, jobID+jobRecordSuffix)
+}
+
+// persistJobLocked must be called with jobMutex held so the snapshot matches
+// the state transition it captures. The record is written in the background.
+func persistJobLocked(jobID string) {
+	job, ok := jobsByID[jobID]
+	if !ok {
+		return
+	}
+	var metrics *ComparisonMetrics
+	if job.Metrics != nil {
+		snapshot := *job.Metrics
+		metrics = &snapshot
+	}
+	record := jobRecord{
+		ID:        jobID,
+		Status:    job.Status,
+		Metrics:   metrics,
+		Options:   job.Options,
+		Created:   job.Created,
+		Started:   job.Started,
+		Completed: job.Completed,
+		Input:     job.Input,
+		Error:     job.Error,
+		Batch:     job.Batch,
+		Hash:      job.InputHash,
+		Filename:  job.Filename,
+		Resumes:   job.Resumes,
+	}
+
+	queueJobRecord(jobID, &record)
+}
+
+func queueJobRecord(jobID string, record *jobRecord) {
+	pendingRecordsMutex.Lock()
+	pendingRecords[jobID] = record
+	pendingRecordsMutex.Unlock()
+	select {
+	case recordsPending <- struct{}{}:
+	default:
+	}
+}
+
+// startJobRecordWriter writes pending records as they are queued.
+func startJobRecordWriter() {
+	go func() {
+		for range recordsPending {
+			flushJobRecords()
+		}
+	}()
+}
+
+// flushJobRecords writes every pending record. Shutdown calls it directly so
+// nothing queued is lost.
+func flushJobRecords() {
+	recordWriteMutex.Lock()
+	defer recordWriteMutex.Unlock()
+
+	pendingRecordsMutex.Lock()
+	records := pendingRecords
+	pendingRecords = make(map[string]*jobRecord)
+	pendingRecordsMutex.Unlock()
+
+	for jobID, record := range records {
+		if record == nil {
+			if err := os.Remove(jobRecordPath(jobID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				jobLogger(jobID).Warn("Failed to remove job record", "error", err)
+			}
+			continue
+		}
+		if err := writeJobRecord(*record); err != nil {
+			jobLogger(jobID).Error("Failed to persist job", "error", err)
+		}
+	}
+}
+
+// discardJobRecordLocked replaces any unwritten snapshot of a deleted job with
+// a removal of its record. The writer removes the file, after any write of
+// an older snapshot it is busy with, so the record cannot come back.
+func discardJobRecordLocked(jobID string) {
+	queueJobRecord(jobID, nil)
+}
+
+func writeJobRecord(record jobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode job record: %v", err)
+	}
+
+	path := jobRecordPath(record.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job record: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace job record: %v", err)
+	}
+	return nil
+}
+
+func loadJobs() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(uploadDir, "*"+jobRecordSuffix))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list job records: %v", err)
+	}
+
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	loaded := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("Skipping unreadable job record", "path", path, "error", err)
+			continue
+		}
+
+		var record jobRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.ID == "" {
+			slog.Warn("Skipping corrupt job record", "path", path, "error", err)
+			continue
+		}
+		if record.ID != strings.TrimSuffix(filepath.Base(path), jobRecordSuffix) {
+			slog.Warn("Skipping job record with mismatched ID", "path", path, "jobID", record.ID)
+			continue
+		}
+
+		job := &Job{
+			ID:        record.ID,
+			Status:    record.Status,
+			Metrics:   record.Metrics,
+			Options:   record.Options,
+			Created:   record.Created,
+			Started:   record.Started,
+			Completed: record.Completed,
+			Input:     record.Input,
+			Error:     record.Error,
+			Batch:     record.Batch,
+			InputHash: record.Hash,
+			Filename:  record.Filename,
+			Resumes:   record.Resumes,
+		}
+		jobsByID[record.ID] = job
+		indexJobHashLocked(job)
+
+		if record.Status == "processing" || record.Status == "queued" {
+			reason := resumeBlocker(job)
+			if autoResume && reason == "" {
+				resumeJobLocked(job, record.Status)
+				loaded++
+				continue
+			}
+			if autoResume {
+				jobLogger(record.ID).Warn("Interrupted job cannot be resumed", "reason", reason)
+			}
+			jobLogger(record.ID).Warn("Job was interrupted when the server stopped, marking it failed", "event", "job_failed", "status", record.Status)
+			job.Status = "failed"
+			job.Completed = time.Now()
+			job.Error = &JobError{
+				Message: fmt.Sprintf("server stopped while the job was %s", record.Status),
+			}
+			recordFailedStats()
+			persistJobLocked(record.ID)
+		}
+		loaded++
+	}
+
+	return loaded, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJobRecordsAreWrittenAfterTheLock(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	addJob(&Job{ID: "persisted", Status: "queued", Created: time.Now()})
+	t.Cleanup(func() { deleteJob("persisted") })
+
+	jobMutex.Lock()
+	persistJobLocked("persisted")
+	jobsByID["persisted"].Status = "processing"
+	persistJobLocked("persisted")
+	jobMutex.Unlock()
+
+	if _, err := os.Stat(jobRecordPath("persisted")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("record written before the flush: %v", err)
+	}
+
+	flushJobRecords()
+	data, err := os.ReadFile(jobRecordPath("persisted"))
+	if err != nil {
+		t.Fatalf("record not written: %v", err)
+	}
+	var record jobRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("corrupt record: %v", err)
+	}
+	if record.Status != "processing" {
+		t.Errorf("record status = %q, want the latest snapshot processing", record.Status)
+	}
+}
+
+func TestDeletedJobRecordIsNotWritten(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	addJob(&Job{ID: "deleted-record", Status: "queued", Created: time.Now()})
+	jobMutex.Lock()
+	persistJobLocked("deleted-record")
+	jobMutex.Unlock()
+	deleteJob("deleted-record")
+
+	flushJobRecords()
+	if _, err := os.Stat(jobRecordPath("deleted-record")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("record of a deleted job was written: %v", err)
+	}
+}
+
+func TestDeletedJobRecordIsRemovedByTheWriter(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	addJob(&Job{ID: "written-record", Status: "complete", Created: time.Now()})
+	jobMutex.Lock()
+	persistJobLocked("written-record")
+	jobMutex.Unlock()
+	flushJobRecords()
+
+	recordWriteMutex.Lock()
+	deleted := make(chan struct{})
+	go func() {
+		deleteJob("written-record")
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deleteJob waited for the record writer")
+	}
+	recordWriteMutex.Unlock()
+
+	flushJobRecords()
+	if _, err := os.Stat(jobRecordPath("written-record")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("record of a deleted job was kept: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	phaseProbing     = "probing"
+	phaseNormalizing = "normalizing"
+	phaseLoudness    = "loudness"
+	phaseFirstPass   = "firstPass"
+	phaseEncoding    = "encoding"
+	phaseVMAF        = "vmaf"
+	phaseThumbnail   = "thumbnail"
+	phaseWaveform    = "waveform"
+	phaseFinalizing  = "finalizing"
+)
+
+var phaseWeights = map[string]int{
+	phaseProbing:     5,
+	phaseNormalizing: 40,
+	phaseLoudness:    10,
+	phaseFirstPass:   60,
+	phaseEncoding:    80,
+	phaseVMAF:        30,
+	phaseThumbnail:   5,
+	phaseWaveform:    5,
+	phaseFinalizing:  5,
+}
+
+type JobProgress struct {
+	Phase         string   `json:"phase"`
+	PhaseProgress int      `json:"phaseProgress"`
+	Overall       int      `json:"progress"`
+	Phases        []string `json:"phases"`
+	ETASeconds    *int     `json:"etaSeconds,omitempty"`
+}
+
+func startJobPhases(jobID string, phases ...string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok {
+		job.Progress = &JobProgress{Phase: phases[0], Phases: phases}
+	}
+}
+
+func setJobPhases(jobID string, phases ...string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	progress := jobProgressLocked(jobID)
+	if progress == nil {
+		return
+	}
+	progress.Phases = phases
+	progress.Overall = overallProgress(progress)
+}
+
+func insertJobPhase(jobID, phase, before string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	progress := jobProgressLocked(jobID)
+	if progress == nil || slices.Contains(progress.Phases, phase) {
+		return
+	}
+	index := slices.Index(progress.Phases, before)
+	if index < 0 {
+		return
+	}
+	progress.Phases = slices.Insert(slices.Clone(progress.Phases), index, phase)
+	progress.Overall = overallProgress(progress)
+}
+
+func setJobPhase(jobID, phase string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	progress := jobProgressLocked(jobID)
+	if progress == nil {
+		return
+	}
+	progress.Phase = phase
+	progress.PhaseProgress = 0
+	progress.ETASeconds = nil
+	progress.Overall = overallProgress(progress)
+	notifyJobLocked(jobID)
+}
+
+func setJobPhaseProgress(jobID string, percent int) {
+	percent = max(0, min(percent, 100))
+
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	progress := jobProgressLocked(jobID)
+	if progress == nil {
+		return
+	}
+	progress.PhaseProgress = percent
+	if overall := overallProgress(progress); overall != progress.Overall {
+		progress.Overall = overall
+		notifyJobLocked(jobID)
+	}
+}
+
+func setJobPhaseETA(jobID string, seconds *int) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if progress := jobProgressLocked(jobID); progress != nil {
+		progress.ETASeconds = seconds
+	}
+}
+
+func jobProgressLocked(jobID string) *JobProgress {
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Progress
+	}
+	return nil
+}
+
+func getJobProgress(jobID string) *JobProgress {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	progress := jobProgressLocked(jobID)
+	if progress == nil {
+		return nil
+	}
+	snapshot := *progress
+	return &snapshot
+}
+
+func overallProgress(progress *JobProgress) int {
+	total, done := 0, 0
+	for _, phase := range progress.Phases {
+		weight := phaseWeights[phase]
+		total += weight
+		if phase == progress.Phase {
+			done = total - weight + weight*progress.PhaseProgress/100
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return done * 100 / total
+}
+
+func runFFmpegWithProgress(ctx context.Context, jobID string, args []string, duration float64, niceness int) ([]byte, error) {
+	cmd := ffmpegCommand(ctx, append([]string{"-progress", "pipe:1", "-nostats"}, args...), niceness)
+
+	stderr := newTailBuffer(ffmpegLogTailSize)
+	cmd.Stderr = stderr
+	if logFile := openJobLog(jobID, args); logFile != nil {
+		defer logFile.Close()
+		cmd.Stderr = io.MultiWriter(stderr, logFile)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach ffmpeg progress pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var outSeconds float64
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		if key == "progress" && value == "end" {
+			setJobPhaseProgress(jobID, 100)
+			setJobPhaseETA(jobID, nil)
+			continue
+		}
+
+		if key == "speed" && duration > 0 {
+			setJobPhaseETA(jobID, estimateRemaining(duration, outSeconds, value))
+			continue
+		}
+
+		// ffmpeg reports out_time_ms in microseconds as well, and older
+		// builds only emit that key.
+		if (key != "out_time_us" && key != "out_time_ms") || duration <= 0 {
+			continue
+		}
+
+		outTime, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		outSeconds = float64(outTime) / 1e6
+		setJobPhaseProgress(jobID, min(int(outSeconds/duration*100), 99))
+	}
+	io.Copy(io.Discard, stdout)
+
+	err = cmd.Wait()
+	return stderr.Bytes(), err
+}
+
+// estimateRemaining turns ffmpeg's speed field, e.g. "2.5x", into the wall-clock
+// seconds left for the rest of the media. ffmpeg reports N/A until it has
+// timed enough frames, in which case there is no estimate.
+func estimateRemaining(duration, outSeconds float64, speed string) *int {
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(speed), "x"), 64)
+	if err != nil || factor <= 0 || outSeconds <= 0 {
+		return nil
+	}
+	remaining := int(math.Ceil(max(duration-outSeconds, 0) / factor))
+	return &remaining
+}
+
+func ffmpegCommand(ctx context.Context, args []string, niceness int) *exec.Cmd {
+	if niceness > 0 {
+		return exec.CommandContext(ctx, "nice", append([]string{"-n", strconv.Itoa(niceness), ffmpegPath}, args...)...)
+	}
+	return exec.CommandContext(ctx, ffmpegPath, args...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	qualityMetricVMAF = "vmaf"
+	qualityMetricPSNR = "psnr"
+)
+
+var (
+	vmafScorePattern = regexp.MustCompile(`VMAF score: ([\d.]+)`)
+	psnrScorePattern = regexp.MustCompile(`PSNR .*average:([\d.]+|inf)`)
+
+	vmafOnce      sync.Once
+	vmafAvailable bool
+)
+
+func supportsVMAF() bool {
+	vmafOnce.Do(func() {
+		filters, err := exec.Command(ffmpegPath, "-hide_banner", "-filters").Output()
+		vmafAvailable = err == nil && strings.Contains(string(filters), "libvmaf")
+	})
+	return vmafAvailable
+}
+
+// measureQuality scores the compressed output against the original at the
+// original's resolution, using VMAF when ffmpeg has libvmaf and PSNR otherwise.
+func measureQuality(ctx context.Context, jobID, originalPath, compressedPath string, width, height int, duration float64, trim []string) (float64, string, error) {
+	metric, pattern := qualityMetricPSNR, psnrScorePattern
+	if supportsVMAF() {
+		metric, pattern = qualityMetricVMAF, vmafScorePattern
+	}
+
+	graph := fmt.Sprintf(
+		"[0:v]scale=%d:%d:flags=bicubic,format=yuv420p,setpts=PTS-STARTPTS[dist];"+
+			"[1:v]format=yuv420p,setpts=PTS-STARTPTS[ref];[dist][ref]%s",
+		width, height, metric,
+	)
+
+	args := []string{"-i", compressedPath}
+	args = append(args, trim...)
+	args = append(args, "-i", originalPath, "-lavfi", graph, "-f", "null", os.DevNull)
+
+	output, err := runFFmpegWithProgress(ctx, jobID, args, duration, 0)
+	if err != nil {
+		return 0, metric, fmt.Errorf("%v: %s", err, outputTail(output))
+	}
+
+	match := pattern.FindSubmatch(output)
+	if match == nil {
+		return 0, metric, fmt.Errorf("no %s score in ffmpeg output", metric)
+	}
+	if string(match[1]) == "inf" {
+		return 100, metric, nil
+	}
+
+	score, err := strconv.ParseFloat(string(match[1]), 64)
+	if err != nil {
+		return 0, metric, fmt.Errorf("invalid %s score %q: %v", metric, match[1], err)
+	}
+	return score, metric, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxQueuedJobs = 1000
+
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+
+	// priorityAgingInterval is how long a queued job waits before it competes
+	// one level higher, so a steady stream of high priority work can't starve
+	// low priority jobs.
+	priorityAgingInterval = 2 * time.Minute
+)
+
+var priorityLevels = []string{priorityHigh, priorityNormal, priorityLow}
+
+// queueOrder holds the queued job IDs in the order they were enqueued; the
+// dispatcher picks from it by effective priority. Guarded by jobMutex.
+var (
+	queueOrder []string
+	queueReady = sync.NewCond(&jobMutex)
+)
+
+// dispatchOrder caches queueOrder sorted by effective priority until the next
+// job ages a level or the queue changes. It has its own mutex because queue
+// positions are read under jobMutex's read lock.
+var dispatchOrder struct {
+	sync.Mutex
+	order      []string
+	positions  map[string]int
+	validUntil time.Time
+}
+
+func (o CompressionOptions) priority() string {
+	if o.Priority == "" {
+		return priorityNormal
+	}
+	return o.Priority
+}
+
+// effectivePriorityLocked is the job's priority raised one level for every
+// priorityAgingInterval it has been waiting.
+func effectivePriorityLocked(job *Job, now time.Time) int {
+	level := slices.Index(priorityLevels, job.Options.priority())
+	aged := int(now.Sub(job.Created) / priorityAgingInterval)
+	return max(level-aged, 0)
+}
+
+// nextAgingLocked is when the job next rises a level, or false when it is
+// already at the top.
+func nextAgingLocked(job *Job, now time.Time) (time.Time, bool) {
+	if effectivePriorityLocked(job, now) == 0 {
+		return time.Time{}, false
+	}
+	aged := now.Sub(job.Created) / priorityAgingInterval
+	return job.Created.Add((aged + 1) * priorityAgingInterval), true
+}
+
+// dispatchPositionsLocked returns the queue sorted by effective priority,
+// keeping the enqueue order between jobs of the same level, and each job's
+// index in it. The result is shared and must not be modified.
+func dispatchPositionsLocked() ([]string, map[string]int) {
+	dispatchOrder.Lock()
+	defer dispatchOrder.Unlock()
+
+	now := time.Now()
+	if now.Before(dispatchOrder.validUntil) {
+		return dispatchOrder.order, dispatchOrder.positions
+	}
+
+	levels := make(map[string]int, len(queueOrder))
+	validUntil := now.Add(priorityAgingInterval)
+	for _, jobID := range queueOrder {
+		job := jobsByID[jobID]
+		levels[jobID] = effectivePriorityLocked(job, now)
+		if next, ok := nextAgingLocked(job, now); ok && next.Before(validUntil) {
+			validUntil = next
+		}
+	}
+
+	order := slices.Clone(queueOrder)
+	slices.SortStableFunc(order, func(a, b string) int {
+		return levels[a] - levels[b]
+	})
+	positions := make(map[string]int, len(order))
+	for i, jobID := range order {
+		positions[jobID] = i
+	}
+
+	dispatchOrder.order, dispatchOrder.positions, dispatchOrder.validUntil = order, positions, validUntil
+	return order, positions
+}
+
+// invalidateDispatchOrderLocked drops the cached order after queueOrder
+// changed. Callers hold jobMutex for writing.
+func invalidateDispatchOrderLocked() {
+	dispatchOrder.Lock()
+	defer dispatchOrder.Unlock()
+	dispatchOrder.validUntil = time.Time{}
+}
+
+func queuePositionLocked(jobID string) int {
+	_, positions := dispatchPositionsLocked()
+	if i, ok := positions[jobID]; ok {
+		return i + 1
+	}
+	return 0
+}
+
+func workerCount() (int, error) {
+	value := os.Getenv("WORKER_COUNT")
+	if value == "" {
+		return max(1, len(gpuDevices)), nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("invalid WORKER_COUNT %q: must be a positive integer", value)
+	}
+	return count, nil
+}
+
+// workerGroup tracks the running workers, so shutdown can wait for the jobs
+// they are processing.
+var workerGroup sync.WaitGroup
+
+func startWorkers(count int) {
+	for i := 0; i < count; i++ {
+		workerGroup.Go(worker)
+	}
+}
+
+func worker() {
+	for {
+		jobID, inputPath, opts, ok := startNextJob()
+		if !ok {
+			return
+		}
+		runJob(jobID, inputPath, opts)
+	}
+}
+
+// compressJob processes a dequeued job. It is a variable so tests can run the
+// workers without ffmpeg.
+var compressJob = compressVideo
+
+// runJob contains a panic in compressVideo to the job that caused it: the job
+// fails with a generic error and the worker moves on to the next one.
+func runJob(jobID, inputPath string, opts CompressionOptions) {
+	defer finishJobRun(jobID)
+	defer func() {
+		if r := recover(); r != nil {
+			jobLogger(jobID).Error("Job panicked", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			failJob(jobID, newJobError(fmt.Errorf("internal error while processing the job"), nil))
+		}
+	}()
+	compressJob(jobID, inputPath, opts)
+}
+
+func enqueueJob(jobID string) bool {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	// The job can be deleted by an admin between addJob and here.
+	job, ok := jobsByID[jobID]
+	if !ok || len(queueOrder) >= maxQueuedJobs {
+		return false
+	}
+
+	appendToQueueLocked(jobID)
+	job.Status = "queued"
+	persistJobLocked(jobID)
+	notifyJobLocked(jobID)
+	queueReady.Signal()
+	return true
+}
+
+// startNextJob blocks until a job is queued and marks the one with the best
+// effective priority as processing. It returns false once the server shuts
+// down.
+func startNextJob() (string, string, CompressionOptions, bool) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	for len(queueOrder) == 0 && !shuttingDown.Load() {
+		queueReady.Wait()
+	}
+	if shuttingDown.Load() {
+		return "", "", CompressionOptions{}, false
+	}
+
+	now := time.Now()
+	order, _ := dispatchPositionsLocked()
+	jobID := order[0]
+	removeFromQueueLocked(jobID)
+	job := jobsByID[jobID]
+	priority := priorityLevels[effectivePriorityLocked(job, now)]
+
+	job.Status = "processing"
+	job.Started = now
+	job.done = make(chan struct{})
+	jobsProcessing.Inc()
+	persistJobLocked(jobID)
+	notifyJobLocked(jobID)
+	jobLogger(jobID).Info("Dequeued job", "event", "job_dequeued", "status", job.Status, "priority", job.Options.priority(),
+		"effectivePriority", priority, "queued", len(queueOrder), "durationMs", now.Sub(job.Created).Milliseconds())
+	return jobID, job.Input, job.Options, true
+}
+
+// finishJobRun signals that the worker is done with the job, whatever state
+// it ended in.
+func finishJobRun(jobID string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok && job.done != nil {
+		close(job.done)
+		job.done = nil
+	}
+}
+
+// stopWorkers wakes idle workers so they notice the shutdown.
+func stopWorkers() {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	queueReady.Broadcast()
+}
+
+func appendToQueueLocked(jobID string) {
+	queueOrder = append(queueOrder, jobID)
+	invalidateDispatchOrderLocked()
+}
+
+func removeFromQueueLocked(jobID string) {
+	if i := slices.Index(queueOrder, jobID); i >= 0 {
+		queueOrder = slices.Delete(queueOrder, i, i+1)
+		invalidateDispatchOrderLocked()
+	}
+}
+
+func getQueuePosition(jobID string) int {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	return queuePositionLocked(jobID)
+}
+
+// getJobPriority returns the requested and the current effective priority of
+// a queued job.
+func getJobPriority(jobID string) (string, string) {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	job, ok := jobsByID[jobID]
+	if !ok {
+		return "", ""
+	}
+	return job.Options.priority(), priorityLevels[effectivePriorityLocked(job, time.Now())]
+}
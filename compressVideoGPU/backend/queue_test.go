@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerRecoversFromPanickingJob(t *testing.T) {
+	previousDir, previousCompress := uploadDir, compressJob
+	uploadDir = t.TempDir()
+	t.Cleanup(func() {
+		uploadDir, compressJob = previousDir, previousCompress
+	})
+
+	processed := make(chan string, 1)
+	compressJob = func(jobID, inputPath string, opts CompressionOptions) {
+		if jobID == "crafted" {
+			panic("runtime error: index out of range [3] with length 0")
+		}
+		processed <- jobID
+	}
+
+	for _, jobID := range []string{"crafted", "next"} {
+		addJob(&Job{ID: jobID, Created: time.Now()})
+		t.Cleanup(func() { deleteJob(jobID) })
+		if !enqueueJob(jobID) {
+			t.Fatalf("failed to enqueue %s", jobID)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		worker()
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		shuttingDown.Store(true)
+		stopWorkers()
+		<-stopped
+		shuttingDown.Store(false)
+	})
+
+	select {
+	case jobID := <-processed:
+		if jobID != "next" {
+			t.Fatalf("worker processed %q, want next", jobID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker stopped taking jobs after the panic")
+	}
+
+	if status := getJobStatus("crafted"); status != "failed" {
+		t.Errorf("panicking job status = %q, want failed", status)
+	}
+	if jobErr := getJobError("crafted"); jobErr == nil || jobErr.Message == "" {
+		t.Errorf("panicking job error = %+v, want an error message", jobErr)
+	}
+}
+
+func TestEnqueueDeletedJob(t *testing.T) {
+	if enqueueJob("deleted") {
+		t.Fatal("enqueued a job that does not exist")
+	}
+	if position := getQueuePosition("deleted"); position != 0 {
+		t.Errorf("queue position of a missing job = %d, want 0", position)
+	}
+}
+
+func TestQueuePositionFollowsPriorityAndAging(t *testing.T) {
+	previousDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = previousDir })
+
+	now := time.Now()
+	jobs := []*Job{
+		{ID: "low", Created: now, Options: CompressionOptions{Priority: priorityLow}},
+		{ID: "high", Created: now, Options: CompressionOptions{Priority: priorityHigh}},
+	}
+	for _, job := range jobs {
+		addJob(job)
+		t.Cleanup(func() {
+			jobMutex.Lock()
+			removeFromQueueLocked(job.ID)
+			jobMutex.Unlock()
+			deleteJob(job.ID)
+		})
+		if !enqueueJob(job.ID) {
+			t.Fatalf("failed to enqueue %s", job.ID)
+		}
+	}
+
+	if position := getQueuePosition("high"); position != 1 {
+		t.Errorf("high priority job position = %d, want 1", position)
+	}
+
+	// A low priority job that waited two aging intervals competes as high,
+	// behind the high priority job that was enqueued before it.
+	addJob(&Job{ID: "aged", Created: now.Add(-2 * priorityAgingInterval), Options: CompressionOptions{Priority: priorityLow}})
+	t.Cleanup(func() {
+		jobMutex.Lock()
+		removeFromQueueLocked("aged")
+		jobMutex.Unlock()
+		deleteJob("aged")
+	})
+	if !enqueueJob("aged") {
+		t.Fatal("failed to enqueue aged")
+	}
+
+	for jobID, want := range map[string]int{"high": 1, "aged": 2, "low": 3} {
+		if position := getQueuePosition(jobID); position != want {
+			t.Errorf("%s position = %d, want %d", jobID, position, want)
+		}
+	}
+}
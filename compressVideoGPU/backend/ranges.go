@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamingContentTypes overrides the system MIME table for HLS files, which
+// often lacks .m3u8 and maps .ts to TypeScript.
+var streamingContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+func fileContentType(filePath string) string {
+	ext := filepath.Ext(filePath)
+	if contentType, ok := streamingContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// serveFileRange sends a file through http.ServeContent, so a <video> tag
+// can seek through an output with Range requests and caches can revalidate
+// it with the ETag.
+func serveFileRange(c *gin.Context, filePath string) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+
+	c.Header("Content-Type", fileContentType(filePath))
+	c.Header("ETag", fileETag(info))
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUploadRateLimit = 30
+	defaultUploadRateBurst = 5
+	rateLimitPruneInterval = time.Minute
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	rate    float64
+	burst   float64
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	limiter := &rateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+	}
+	go limiter.pruneLoop()
+	return limiter
+}
+
+func uploadRateLimits() (int, int, error) {
+	perMinute, burst := defaultUploadRateLimit, defaultUploadRateBurst
+
+	if value := os.Getenv("UPLOAD_RATE_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid UPLOAD_RATE_LIMIT %q: must be a non-negative integer", value)
+		}
+		perMinute = limit
+	}
+	if value := os.Getenv("UPLOAD_RATE_BURST"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("invalid UPLOAD_RATE_BURST %q: must be a positive integer", value)
+		}
+		burst = limit
+	}
+	return perMinute, burst, nil
+}
+
+// allow takes a token for key, or reports how long until one is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely, since a new bucket
+// starts out full anyway.
+func (l *rateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) pruneLoop() {
+	ticker := time.NewTicker(rateLimitPruneInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.prune(now)
+	}
+}
+
+func rateLimitMiddleware(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		key := "ip:" + c.ClientIP()
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			key = "key:" + apiKey
+		}
+
+		allowed, wait := limiter.allow(key, time.Now())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":      "Too many uploads, slow down",
+				"retryAfter": retryAfter,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
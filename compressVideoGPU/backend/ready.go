@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const readinessCacheTTL = 30 * time.Second
+
+type toolCheck struct {
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	readinessMutex   sync.Mutex
+	readinessChecked time.Time
+	ffmpegCheck      toolCheck
+	ffprobeCheck     toolCheck
+	storageCheck     map[string]string
+)
+
+func checkTool(name string) toolCheck {
+	output, err := exec.Command(name, "-version").Output()
+	if err != nil {
+		return toolCheck{Error: err.Error()}
+	}
+
+	// The first line reads "<tool> version <version> Copyright ...".
+	fields := strings.Fields(strings.SplitN(string(output), "\n", 2)[0])
+	if len(fields) < 3 || fields[1] != "version" {
+		return toolCheck{Version: "unknown"}
+	}
+	return toolCheck{Version: fields[2]}
+}
+
+// checkWritable creates, writes and removes a probe file in dir. A volume
+// mounted read-only or with the wrong owner passes MkdirAll but fails here.
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString("ok")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// storageChecks maps each directory the server writes to onto the error of
+// its write probe, or "ok".
+func storageChecks() map[string]string {
+	checks := make(map[string]string)
+	for name, dir := range map[string]string{"uploads": uploadDir, "static": staticDir} {
+		checks[name] = "ok"
+		if err := checkWritable(dir); err != nil {
+			checks[name] = err.Error()
+		}
+	}
+	return checks
+}
+
+func readinessChecks() (toolCheck, toolCheck, map[string]string) {
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	if time.Since(readinessChecked) > readinessCacheTTL {
+		ffmpegCheck = checkTool(ffmpegPath)
+		ffprobeCheck = checkTool(ffprobePath)
+		storageCheck = storageChecks()
+		readinessChecked = time.Now()
+	}
+	return ffmpegCheck, ffprobeCheck, storageCheck
+}
+
+// gpuRequired defaults to false: jobs fall back to CPU encoders without
+// NVENC, so a pod without a working GPU can still serve them.
+func gpuRequired() (bool, error) {
+	value := os.Getenv("REQUIRE_GPU")
+	if value == "" {
+		return false, nil
+	}
+	required, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid REQUIRE_GPU %q: %v", value, err)
+	}
+	return required, nil
+}
+
+func handleReady(requireGPU bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ffmpeg, ffprobe, storage := readinessChecks()
+		// gpuAvailable probes NVENC again once gpuReprobeInterval has passed
+		// since it failed, so a pod recovers without a restart.
+		gpu := gpuAvailable()
+
+		writable := true
+		for _, result := range storage {
+			writable = writable && result == "ok"
+		}
+		ready := ffmpeg.Error == "" && ffprobe.Error == "" && writable && (gpu || !requireGPU)
+
+		status, code := "ready", http.StatusOK
+		switch {
+		case shuttingDown.Load():
+			status, code = "shutting down", http.StatusServiceUnavailable
+		case !ready:
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+
+		c.JSON(code, gin.H{
+			"status":  status,
+			"ffmpeg":  ffmpeg,
+			"ffprobe": ffprobe,
+			"gpu":     gpu,
+			"storage": storage,
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func getJobInput(jobID string) (status, input, inputHash string) {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Status, job.Input, job.InputHash
+	}
+	return "", "", ""
+}
+
+// linkJobInput gives the new job its own name for the source file, so either
+// job can be removed without taking the other's input with it. Hard links
+// cost nothing; a copy is the fallback across filesystems.
+func linkJobInput(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+func handleRejob(c *gin.Context) {
+	sourceID := c.Param("jobID")
+
+	status, sourceInput, inputHash := getJobInput(sourceID)
+	switch status {
+	case "":
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job ID not found",
+		})
+		return
+	case "queued", "processing":
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  fmt.Sprintf("Job is still %s", status),
+			"status": status,
+		})
+		return
+	}
+
+	info, err := os.Stat(sourceInput)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": "The input of this job was already cleaned up, upload the file again",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read job input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	opts, ok := bindCompressionOptions(c)
+	if !ok {
+		return
+	}
+
+	jobID := uuid.New().String()
+	inputPath := filepath.Join(uploadDir, fmt.Sprintf("%s_input%s", jobID, filepath.Ext(sourceInput)))
+	if err := linkJobInput(sourceInput, inputPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save file",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	jobLogger(jobID).Info("Re-running job", "event", "job_rerun", "sourceJobID", sourceID)
+
+	filename := getJobFilename(sourceID)
+	if filename == "" {
+		filename = strings.TrimPrefix(filepath.Base(sourceInput), sourceID+"_")
+	}
+	code, response := submitUploadedJob(jobID, inputPath, filename, info.Size(), opts, "", inputHash)
+	response["sourceJobID"] = sourceID
+	c.JSON(code, response)
+}
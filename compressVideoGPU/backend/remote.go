@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+const (
+	remoteDownloadTimeout = 10 * time.Minute
+	remoteMaxRedirects    = 5
+)
+
+var errBlockedAddress = errors.New("destination address is not allowed")
+
+// blockedNetworks are ranges outside net.IP's private checks that still lead
+// into the provider's network: carrier-grade NAT is used for internal
+// services on several clouds, and the NAT64 prefix embeds an IPv4 address
+// that a NAT64 gateway connects to on the client's behalf.
+var blockedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+var remoteContentTypes = []string{"application/octet-stream", "binary/octet-stream"}
+
+var remoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: guardRemoteAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= remoteMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", remoteMaxRedirects)
+		}
+		return validateRemoteURL(req.URL)
+	},
+}
+
+// guardRemoteAddress runs on the resolved address of every connection,
+// including redirects, so DNS tricks can't reach internal services.
+func guardRemoteAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		slices.ContainsFunc(blockedNetworks, func(network *net.IPNet) bool { return network.Contains(ip) }) {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	return nil
+}
+
+func validateRemoteURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q: must be http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	return nil
+}
+
+func handleCompressURL(c *gin.Context) {
+	var req struct {
+		URL string `json:"url" form:"url"`
+	}
+	// The JSON body is kept so the compression options can be read from it.
+	var err error
+	if c.ContentType() == binding.MIMEJSON {
+		err = c.ShouldBindBodyWithJSON(&req)
+	} else {
+		err = c.ShouldBind(&req)
+	}
+	if err != nil || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A url is required",
+		})
+		return
+	}
+
+	source, err := url.Parse(req.URL)
+	if err == nil {
+		err = validateRemoteURL(source)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid url",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	opts, ok := bindCompressionOptions(c)
+	if !ok {
+		return
+	}
+
+	jobID := uuid.New().String()
+
+	filename := path.Base(source.Path)
+	if filename == "." || filename == "/" {
+		filename = "remote"
+	}
+	downloadPath := filepath.Join(uploadDir, fmt.Sprintf("%s_input", jobID))
+	size, inputHash, err := downloadRemoteVideo(c.Request.Context(), source.String(), downloadPath)
+	if err != nil {
+		os.Remove(downloadPath)
+		status := http.StatusBadGateway
+		if errors.Is(err, errBlockedAddress) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to download video",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	jobLogger(jobID).Info("Downloaded remote video", "event", "download_complete", "url", source.Redacted())
+
+	contentType, err := detectVideoFile(downloadPath)
+	if err != nil {
+		os.Remove(downloadPath)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid file type",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	inputPath := downloadPath + videoExtension(filename, contentType)
+	if err := os.Rename(downloadPath, inputPath); err != nil {
+		os.Remove(downloadPath)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save file",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	queueUploadedJob(c, jobID, inputPath, filename, size, opts, inputHash)
+}
+
+// downloadRemoteVideo saves source to destPath and returns its size and
+// SHA-256.
+func downloadRemoteVideo(ctx context.Context, source, destPath string) (int64, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("remote server responded with %s", resp.Status)
+	}
+
+	if resp.ContentLength > maxFileSize {
+		return 0, "", fmt.Errorf("file too large: maximum size is %dMB", maxFileSize/(1024*1024))
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !(strings.HasPrefix(mediaType, "video/") || slices.Contains(remoteContentTypes, mediaType)) {
+			return 0, "", fmt.Errorf("unexpected content type %q", contentType)
+		}
+	}
+
+	file, err := os.Create(destPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hasher), io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return 0, "", err
+	}
+	if written > maxFileSize {
+		return 0, "", fmt.Errorf("file too large: maximum size is %dMB", maxFileSize/(1024*1024))
+	}
+	return written, hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGuardRemoteAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"127.0.0.1:80", true},
+		{"10.0.0.5:80", true},
+		{"169.254.169.254:80", true},
+		{"100.64.1.1:80", true},
+		{"100.127.255.254:80", true},
+		{"100.128.0.1:80", false},
+		{"[::1]:80", true},
+		{"[64:ff9b::a00:5]:80", true},
+		{"[2606:4700::1111]:443", false},
+	}
+	for _, tt := range tests {
+		err := guardRemoteAddress("tcp", tt.address, nil)
+		if errors.Is(err, errBlockedAddress) != tt.blocked {
+			t.Errorf("guardRemoteAddress(%q) = %v, want blocked %v", tt.address, err, tt.blocked)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	modeEncode = "encode"
+	modeRemux  = "remux"
+)
+
+var webmSourceCodecs = []string{"av1", "vp8", "vp9"}
+
+func (o CompressionOptions) remux() bool {
+	return o.Mode == modeRemux
+}
+
+// buildRemuxArgs copies the selected streams into the requested container
+// without decoding them. With a trim range the cut snaps to the keyframe
+// before startTime, since copied streams cannot start mid-GOP.
+func buildRemuxArgs(p encodeParams) []string {
+	args := []string{"-y"}
+	args = append(args, p.Trim...)
+	args = append(args, "-i", p.Input, "-c", "copy")
+	args = append(args, streamMapArgs(p.Streams)...)
+
+	if p.AudioMode == audioModeStrip {
+		args = append(args, "-an")
+	}
+	// Text subtitles such as SubRip have no MP4 mapping and would fail the copy.
+	if p.Container == "mp4" {
+		args = append(args, "-sn")
+	}
+	if p.StripMetadata {
+		args = append(args, "-map_metadata", "-1", "-map_chapters", "-1")
+	}
+	if p.Fragmented {
+		args = append(args, "-movflags", "frag_keyframe+empty_moov+default_base_moof")
+	}
+	if muxer, ok := containerMuxers[p.Container]; ok {
+		args = append(args, "-f", muxer)
+	}
+	return append(args, p.Output)
+}
+
+func validateRemuxContainer(container, sourceCodec string) error {
+	if container == "webm" && !slices.Contains(webmSourceCodecs, sourceCodec) {
+		return fmt.Errorf("webm only holds AV1, VP8 or VP9 video, %s cannot be copied into it", sourceCodec)
+	}
+	return nil
+}
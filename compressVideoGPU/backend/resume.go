@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxJobResumes stops a job that keeps taking the server down with it from
+// being requeued on every start.
+const maxJobResumes = 3
+
+var autoResume bool
+
+func autoResumeConfig() (bool, error) {
+	value := os.Getenv("AUTO_RESUME")
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid AUTO_RESUME %q: %v", value, err)
+	}
+	return enabled, nil
+}
+
+// resumeBlocker returns why an interrupted job cannot be requeued, or "".
+func resumeBlocker(job *Job) string {
+	if job.Resumes >= maxJobResumes {
+		return fmt.Sprintf("already resumed %d times", job.Resumes)
+	}
+	if _, err := os.Stat(job.Input); err != nil {
+		return "the input file is gone"
+	}
+	return ""
+}
+
+// resumeJobLocked puts a job that was queued or processing when the server
+// stopped back in the queue. Whatever a processing job had written is
+// discarded, so the encode starts over from the input.
+func resumeJobLocked(job *Job, previous string) {
+	if previous == "processing" {
+		os.Remove(filepath.Join(staticDir, outputFilename(job.ID, job.Options)))
+		if job.Options.hls() {
+			removeHLSOutput(job.ID)
+		}
+	}
+	job.Status = "queued"
+	job.Started = time.Time{}
+	job.Resumes++
+	appendToQueueLocked(job.ID)
+	persistJobLocked(job.ID)
+	jobLogger(job.ID).Info("Resuming job interrupted by the restart", "event", "job_resumed", "status", previous, "resumes", job.Resumes)
+}
+
+// interruptJob stops a processing job at shutdown without failing it, so the
+// next start resumes it. The record is only written once the job has exited,
+// after ffmpeg is killed and the partial output removed; it reports false
+// when the job does not exit within the timeout. A job that finished in the
+// meantime is left alone.
+func interruptJob(jobID string, timeout time.Duration) bool {
+	jobMutex.Lock()
+	job, ok := jobsByID[jobID]
+	if !ok || job.Status != "processing" {
+		jobMutex.Unlock()
+		return true
+	}
+	cancel, done := job.cancel, job.done
+	jobMutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			return false
+		}
+	}
+
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job.Status == "processing" {
+		persistJobLocked(jobID)
+	}
+	return true
+}
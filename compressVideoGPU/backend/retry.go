@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const encodeRetryBackoff = 2 * time.Second
+
+var defaultRetryableErrors = []string{
+	"out of memory",
+	"incompatible client key",
+	"CUDA_ERROR_OUT_OF_MEMORY",
+	"Resource temporarily unavailable",
+}
+
+func (s *Settings) retryable(output []byte) bool {
+	for _, marker := range s.RetryableErrors {
+		if strings.Contains(string(output), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableEncode reports whether a failed encode is worth repeating: the
+// output matches a configured retryable error, or NVENC was merely busy.
+func retryableEncode(encoder string, output []byte) bool {
+	return settings.retryable(output) || (isNVENC(encoder) && nvencBusy(output))
+}
+
+// runEncodeWithRetry repeats an encode that failed with one of the configured
+// transient errors, such as NVENC running out of memory or sessions, waiting a
+// little longer before every attempt. Any other failure is returned at once.
+func runEncodeWithRetry(ctx context.Context, jobID string, p encodeParams, duration float64, start, deadline time.Time) ([]byte, bool, error) {
+	output, downgraded, err := runEncode(ctx, jobID, p, duration, start, deadline)
+	for attempt := 1; attempt <= settings.EncodeRetries && err != nil && retryableEncode(p.Encoder, output); attempt++ {
+		backoff := time.Duration(attempt) * encodeRetryBackoff
+		jobLogger(jobID).Warn("Encode hit a transient error, retrying", "event", "encode_retry", "encoder", p.Encoder,
+			"attempt", attempt, "retries", settings.EncodeRetries, "backoff", backoff.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return output, downgraded, err
+		case <-time.After(backoff):
+		}
+
+		setJobPhaseProgress(jobID, 0)
+		output, downgraded, err = runEncode(ctx, jobID, p, duration, start, deadline)
+	}
+	return output, downgraded, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+type probeSideData struct {
+	Type     string  `json:"side_data_type"`
+	Rotation float64 `json:"rotation"`
+}
+
+// probeRotation returns the clockwise display rotation of a video stream in
+// degrees (0, 90, 180 or 270). Newer ffprobe versions report the display
+// matrix as side data with a counterclockwise angle, older ones a rotate tag
+// that is already clockwise.
+func probeRotation(sideData []probeSideData, tags map[string]string) int {
+	degrees := 0.0
+	for _, entry := range sideData {
+		if entry.Type == "Display Matrix" {
+			degrees = -entry.Rotation
+		}
+	}
+	if degrees == 0 {
+		degrees, _ = strconv.ParseFloat(tags["rotate"], 64)
+	}
+
+	rotation := int(math.Round(degrees/90)) * 90 % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+// rotatesDimensions reports whether the stored frames are displayed with
+// width and height swapped.
+func rotatesDimensions(rotation int) bool {
+	return rotation == 90 || rotation == 270
+}
+
+// rotationInputArgs asks ffmpeg to transpose the decoded frames according to
+// the display matrix before any filter runs, so scaling and watermarks work
+// on the upright picture. It only applies to software frames, which is why
+// rotated sources never use GPU scaling.
+func rotationInputArgs() []string {
+	return []string{"-autorotate"}
+}
+
+// rotationFilter is the transpose chain that turns frames stored with the
+// given clockwise display rotation upright, or "" when they already are.
+func rotationFilter(rotation int) string {
+	switch rotation {
+	case 90:
+		return "transpose=clock"
+	case 180:
+		return "hflip,vflip"
+	case 270:
+		return "transpose=cclock"
+	}
+	return ""
+}
+
+// rotationOutputArgs clears the legacy rotate tag; otherwise players would
+// turn the already upright output a second time.
+func rotationOutputArgs() []string {
+	return []string{"-metadata:s:v", "rotate=0"}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// portraitPhoneStream is the ffprobe video stream of a portrait clip recorded
+// on a phone: the frames are stored landscape with a 90 degree rotation.
+const portraitPhoneStream = `{
+	"codec_type": "video",
+	"codec_name": "hevc",
+	"width": 1920,
+	"height": 1080,
+	"pix_fmt": "yuv420p",
+	"tags": {"rotate": "90", "handler_name": "Core Media Video"},
+	"side_data_list": [{"side_data_type": "Display Matrix", "displaymatrix": "...", "rotation": -90}]
+}`
+
+func portraitPhoneRotation(t *testing.T) int {
+	t.Helper()
+	var stream struct {
+		SideDataList []probeSideData   `json:"side_data_list"`
+		Tags         map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(portraitPhoneStream), &stream); err != nil {
+		t.Fatalf("failed to parse stream: %v", err)
+	}
+	return probeRotation(stream.SideDataList, stream.Tags)
+}
+
+func TestProbeRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		sideData []probeSideData
+		tags     map[string]string
+		want     int
+	}{
+		{"none", nil, nil, 0},
+		{"rotate tag", nil, map[string]string{"rotate": "90"}, 90},
+		{"display matrix", []probeSideData{{Type: "Display Matrix", Rotation: -90}}, nil, 90},
+		{"display matrix counterclockwise", []probeSideData{{Type: "Display Matrix", Rotation: 90}}, nil, 270},
+		{"upside down", []probeSideData{{Type: "Display Matrix", Rotation: 180}}, nil, 180},
+		{"matrix wins over tag", []probeSideData{{Type: "Display Matrix", Rotation: -270}}, map[string]string{"rotate": "90"}, 270},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probeRotation(tt.sideData, tt.tags); got != tt.want {
+				t.Errorf("probeRotation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailOfPortraitPhoneClipIsUpright(t *testing.T) {
+	rotation := portraitPhoneRotation(t)
+	if rotation != 90 || !rotatesDimensions(rotation) {
+		t.Fatalf("rotation = %d, want 90", rotation)
+	}
+
+	args := thumbnailArgs("portrait.mp4", "thumb.jpg", 1, rotation)
+	if i := slices.Index(args, "-noautorotate"); i < 0 || i > slices.Index(args, "-i") {
+		t.Errorf("args %q do not disable autorotation for the input", args)
+	}
+	if i := slices.Index(args, "-vf"); i < 0 || args[i+1] != "transpose=clock" {
+		t.Errorf("args %q do not transpose the frame upright", args)
+	}
+
+	upright := thumbnailArgs("upright.mp4", "thumb.jpg", 1, 0)
+	if slices.Contains(upright, "-noautorotate") || slices.Contains(upright, "-vf") {
+		t.Errorf("args %q rotate an upright video", upright)
+	}
+}
+
+func TestBuildFFmpegArgsRotatesPortraitPhoneClip(t *testing.T) {
+	source := &VideoMetrics{
+		Width:       1080,
+		Height:      1920,
+		Duration:    10,
+		VideoCodec:  "hevc",
+		FrameRate:   "30",
+		PixelFormat: "yuv420p",
+		ColorSpace:  "bt709",
+		Rotation:    portraitPhoneRotation(t),
+	}
+
+	env := ffmpegEnv{Input: "/uploads/job_input.mp4", Output: "/static/job_compressed.mp4", GPUAvailable: true}
+	plan, err := buildFFmpegArgs(CompressionOptions{Codec: "h264_nvenc", TargetHeight: 1280}, source, env)
+	if err != nil {
+		t.Fatalf("buildFFmpegArgs: %v", err)
+	}
+	args, _ := buildEncodeArgs(plan.Params)
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-autorotate -i", "scale=-2:1280", "-metadata:s:v rotate=0"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("encode args %q do not contain %q", joined, want)
+		}
+	}
+	if plan.Params.GPUScaling {
+		t.Error("rotated source uses GPU scaling, which skips autorotation")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	httpShutdownTimeout    = 5 * time.Second
+
+	// cancelledJobsTimeout bounds the wait for cancelled jobs to kill ffmpeg
+	// and remove their partial output.
+	cancelledJobsTimeout = 10 * time.Second
+)
+
+var shuttingDown atomic.Bool
+
+// jobContext is the parent of every job's context. Cancelling it at shutdown
+// also reaches jobs that were dequeued but have not started ffmpeg yet.
+var jobContext, cancelJobs = context.WithCancel(context.Background())
+
+func shutdownTimeout() (time.Duration, error) {
+	value := os.Getenv("SHUTDOWN_TIMEOUT")
+	if value == "" {
+		return defaultShutdownTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q: must be a non-negative duration such as 30s", value)
+	}
+	return timeout, nil
+}
+
+func acceptingUploads() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shuttingDown.Load() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Server is shutting down and not accepting new uploads",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func processingJobs() []string {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+
+	var jobIDs []string
+	for jobID, job := range jobsByID {
+		if job.Status == "processing" {
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+	return jobIDs
+}
+
+// waitForWorkers waits until every worker has returned, or the timeout
+// passes. It reports whether the workers are done.
+func waitForWorkers(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		workerGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// shutdown stops new uploads and queued work and gives in-flight jobs until
+// the timeout to finish. Jobs that do not are failed, or left to resume after
+// the restart, and cancelled; the server waits for them to stop ffmpeg and
+// clean up before it closes.
+func shutdown(server *http.Server, timeout time.Duration) {
+	shuttingDown.Store(true)
+	stopWorkers()
+
+	if remaining := processingJobs(); len(remaining) > 0 {
+		slog.Info("Waiting for in-flight jobs to finish", "event", "shutdown", "timeout", timeout.String(), "jobs", len(remaining))
+	}
+
+	if !waitForWorkers(timeout) {
+		remaining := processingJobs()
+		if !autoResume {
+			for _, jobID := range remaining {
+				jobLogger(jobID).Warn("Job did not finish before shutdown, marking it failed", "event", "shutdown")
+				failJob(jobID, newJobError(fmt.Errorf("server shut down before the job finished"), nil))
+			}
+		}
+		cancelJobs()
+		if autoResume {
+			for _, jobID := range remaining {
+				if interruptJob(jobID, cancelledJobsTimeout) {
+					jobLogger(jobID).Warn("Job did not finish before shutdown, it resumes after the restart", "event", "shutdown")
+				}
+			}
+		}
+		if !waitForWorkers(cancelledJobsTimeout) {
+			slog.Error("Cancelled jobs did not stop in time", "event", "shutdown", "jobs", processingJobs())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("HTTP server did not shut down cleanly", "error", err)
+		server.Close()
+	}
+	flushJobRecords()
+	slog.Info("Server stopped", "event", "shutdown")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobTotals holds running sums over every finished job, kept next to the job
+// records so a restart or the janitor removing old jobs does not reset them.
+type jobTotals struct {
+	Since                time.Time `json:"since"`
+	JobsCompleted        int64     `json:"jobsCompleted"`
+	JobsFailed           int64     `json:"jobsFailed"`
+	OriginalBytes        int64     `json:"originalBytes"`
+	CompressedBytes      int64     `json:"compressedBytes"`
+	CompressionRatioSum  float64   `json:"compressionRatioSum"`
+	ProcessingSecondsSum float64   `json:"processingSecondsSum"`
+}
+
+var (
+	totals      jobTotals
+	totalsMutex sync.Mutex
+)
+
+func statsPath() string {
+	return filepath.Join(uploadDir, "stats.json")
+}
+
+func loadStats() error {
+	totalsMutex.Lock()
+	defer totalsMutex.Unlock()
+
+	data, err := os.ReadFile(statsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		totals = jobTotals{Since: time.Now()}
+		return writeStatsLocked()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read stats: %v", err)
+	}
+	if err := json.Unmarshal(data, &totals); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", statsPath(), err)
+	}
+	return nil
+}
+
+func writeStatsLocked() error {
+	data, err := json.Marshal(totals)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %v", err)
+	}
+	tmpPath := statsPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stats: %v", err)
+	}
+	if err := os.Rename(tmpPath, statsPath()); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace stats: %v", err)
+	}
+	return nil
+}
+
+func updateStats(update func(*jobTotals)) {
+	totalsMutex.Lock()
+	defer totalsMutex.Unlock()
+	update(&totals)
+	if err := writeStatsLocked(); err != nil {
+		slog.Error("Failed to persist stats", "error", err)
+	}
+}
+
+func recordCompletedStats(metrics *ComparisonMetrics, processing time.Duration) {
+	original, compressed := metrics.Original.Size, metrics.Compressed.Size
+	updateStats(func(t *jobTotals) {
+		t.JobsCompleted++
+		t.OriginalBytes += original
+		t.CompressedBytes += compressed
+		if original > 0 {
+			t.CompressionRatioSum += float64(original-compressed) / float64(original) * 100
+		}
+		t.ProcessingSecondsSum += processing.Seconds()
+	})
+}
+
+func recordFailedStats() {
+	updateStats(func(t *jobTotals) {
+		t.JobsFailed++
+	})
+}
+
+func handleStats(c *gin.Context) {
+	totalsMutex.Lock()
+	t := totals
+	totalsMutex.Unlock()
+
+	response := gin.H{
+		"since":           t.Since,
+		"jobsCompleted":   t.JobsCompleted,
+		"jobsFailed":      t.JobsFailed,
+		"originalBytes":   t.OriginalBytes,
+		"compressedBytes": t.CompressedBytes,
+		"bytesSaved":      t.OriginalBytes - t.CompressedBytes,
+	}
+	if t.JobsCompleted > 0 {
+		response["averageCompressionRatio"] = fmt.Sprintf("%.2f", t.CompressionRatioSum/float64(t.JobsCompleted))
+		response["averageProcessingTime"] = fmt.Sprintf("%.2fs", t.ProcessingSecondsSum/float64(t.JobsCompleted))
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxStatusBatchIDs = 100
+	statusNotFound    = "not_found"
+)
+
+type jobStatusSnapshot struct {
+	Status  string             `json:"status"`
+	Metrics *ComparisonMetrics `json:"metrics,omitempty"`
+}
+
+// jobStatusSnapshots reads the status and metrics of every job under one read
+// lock, so the batch reflects a single point in time. Unknown IDs are marked
+// not_found instead of being left out.
+func jobStatusSnapshots(jobIDs []string) map[string]jobStatusSnapshot {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+
+	snapshots := make(map[string]jobStatusSnapshot, len(jobIDs))
+	for _, jobID := range jobIDs {
+		job, ok := jobsByID[jobID]
+		if !ok {
+			snapshots[jobID] = jobStatusSnapshot{Status: statusNotFound}
+			continue
+		}
+		snapshot := jobStatusSnapshot{Status: job.Status}
+		if job.Metrics != nil {
+			metrics := *job.Metrics
+			snapshot.Metrics = &metrics
+		}
+		snapshots[jobID] = snapshot
+	}
+	return snapshots
+}
+
+func handleStatusBatch(c *gin.Context) {
+	var jobIDs []string
+	if err := c.ShouldBindJSON(&jobIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid job ID list",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if len(jobIDs) == 0 || len(jobIDs) > maxStatusBatchIDs {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Between 1 and %d job IDs are required", maxStatusBatchIDs),
+		})
+		return
+	}
+
+	snapshots := jobStatusSnapshots(jobIDs)
+	for _, snapshot := range snapshots {
+		if snapshot.Metrics != nil {
+			snapshot.Metrics.ThumbnailURL = outputURL(snapshot.Metrics.ThumbnailURL)
+			snapshot.Metrics.WaveformURL = outputURL(snapshot.Metrics.WaveformURL)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": snapshots,
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	defaultUploadDir     = "./uploads"
+	defaultStaticDir     = "./static"
+	defaultMaxFileSizeMB = 500
+)
+
+var (
+	uploadDir         = defaultUploadDir
+	staticDir         = defaultStaticDir
+	maxFileSize int64 = defaultMaxFileSizeMB * 1024 * 1024
+	// maxDuration caps the source length in seconds; 0 means no limit.
+	maxDuration float64
+)
+
+func storageConfig() (string, string, int64, error) {
+	uploads, static := defaultUploadDir, defaultStaticDir
+	if value := os.Getenv("UPLOAD_DIR"); value != "" {
+		uploads = filepath.Clean(value)
+	}
+	if value := os.Getenv("STATIC_DIR"); value != "" {
+		static = filepath.Clean(value)
+	}
+
+	uploadsAbs, err := filepath.Abs(uploads)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid UPLOAD_DIR %q: %v", uploads, err)
+	}
+	staticAbs, err := filepath.Abs(static)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid STATIC_DIR %q: %v", static, err)
+	}
+	if uploadsAbs == staticAbs {
+		return "", "", 0, fmt.Errorf("UPLOAD_DIR and STATIC_DIR must be different directories, both are %s", uploadsAbs)
+	}
+
+	sizeMB := int64(defaultMaxFileSizeMB)
+	if value := os.Getenv("MAX_FILE_SIZE_MB"); value != "" {
+		sizeMB, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || sizeMB <= 0 || sizeMB > 1024*1024 {
+			return "", "", 0, fmt.Errorf("invalid MAX_FILE_SIZE_MB %q: must be a positive number of megabytes", value)
+		}
+	}
+	return uploads, static, sizeMB * 1024 * 1024, nil
+}
+
+func maxDurationConfig() (float64, error) {
+	value := os.Getenv("MAX_DURATION_SECONDS")
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid MAX_DURATION_SECONDS %q: must be a non-negative number of seconds", value)
+	}
+	return seconds, nil
+}
+
+// validateDuration rejects sources longer than MAX_DURATION_SECONDS. A long
+// low-bitrate file passes the size limit but still occupies an encoder for
+// as long as a large one.
+func validateDuration(duration float64) error {
+	if maxDuration > 0 && duration > maxDuration {
+		return fmt.Errorf("the video is %.0fs long, the maximum is %.0fs", duration, maxDuration)
+	}
+	return nil
+}
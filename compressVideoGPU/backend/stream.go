@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const streamPollInterval = 250 * time.Millisecond
+
+// streamStatusTrailer carries the job status once a fragmented stream ends.
+const streamStatusTrailer = "X-Job-Status"
+
+func handleStream(c *gin.Context) {
+	jobID := c.Param("jobID")
+
+	status := getJobStatus(jobID)
+	if status == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job ID not found",
+		})
+		return
+	}
+
+	opts := getJobOptions(jobID)
+	outputPath := filepath.Join(staticDir, outputFilename(jobID, opts))
+
+	if _, local := outputs.(localStore); status == "complete" && !local {
+		c.Redirect(http.StatusFound, outputs.URL(outputFilename(jobID, opts)))
+		return
+	}
+
+	if !opts.Fragmented {
+		if status != "complete" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Output is not fragmented and can only be downloaded once the job completes",
+				"status": status,
+			})
+			return
+		}
+		serveFileRange(c, outputPath)
+		return
+	}
+
+	file, err := waitForOutput(c, jobID, outputPath)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Output is not available for streaming",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Trailer", streamStatusTrailer)
+	c.Status(http.StatusOK)
+
+	buf := make([]byte, 64*1024)
+	finalStatus := ""
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			abortStream(c)
+			return
+		}
+		if finalStatus != "" {
+			break
+		}
+
+		// One more read after the job finished picks up its last bytes.
+		if status := getJobStatus(jobID); status != "processing" {
+			finalStatus = status
+			continue
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(streamPollInterval):
+		}
+	}
+
+	c.Writer.Header().Set(streamStatusTrailer, finalStatus)
+	if finalStatus != "complete" {
+		abortStream(c)
+	}
+}
+
+// abortStream ends a stream whose job failed or was cancelled by closing the
+// connection before the final chunk, so clients get a truncated body error
+// instead of what looks like a finished download. HTTP/2 connections cannot
+// be hijacked; those clients have to check the status trailer.
+func abortStream(c *gin.Context) {
+	// gin refuses to hijack a response that has been written to, net/http
+	// does not.
+	var w http.ResponseWriter = c.Writer
+	if unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		w = unwrapper.Unwrap()
+	}
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+func waitForOutput(c *gin.Context, jobID, outputPath string) (*os.File, error) {
+	for {
+		file, err := os.Open(outputPath)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if status := getJobStatus(jobID); status != "processing" && status != "queued" {
+			return nil, fmt.Errorf("job is %s and produced no output", status)
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return nil, c.Request.Context().Err()
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
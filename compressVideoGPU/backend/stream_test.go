@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamSignalsHowTheJobEnded(t *testing.T) {
+	previousStatic := staticDir
+	staticDir = t.TempDir()
+	t.Cleanup(func() { staticDir = previousStatic })
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/stream/:jobID", handleStream)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	for _, status := range []string{"complete", "failed", "cancelled"} {
+		t.Run(status, func(t *testing.T) {
+			jobID := "stream-" + status
+			opts := CompressionOptions{Fragmented: true}
+			addJob(&Job{ID: jobID, Status: status, Created: time.Now(), Options: opts})
+			t.Cleanup(func() { deleteJob(jobID) })
+			if err := os.WriteFile(filepath.Join(staticDir, outputFilename(jobID, opts)), []byte("fragment"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.Get(server.URL + "/stream/" + jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+
+			if status == "complete" {
+				if err != nil {
+					t.Fatalf("reading a completed stream: %v", err)
+				}
+				if got := resp.Trailer.Get(streamStatusTrailer); got != "complete" {
+					t.Errorf("status trailer = %q, want complete", got)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("stream of a %s job ended like a finished download", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxStreamSelections = 32
+
+// StreamInfo lists a stream of the source as ffprobe numbers it, which is the
+// index the streams option refers to.
+type StreamInfo struct {
+	Index       int    `json:"index"`
+	Type        string `json:"type"`
+	Codec       string `json:"codec"`
+	Language    string `json:"language,omitempty"`
+	AttachedPic bool   `json:"attachedPic,omitempty"`
+}
+
+// streamSelection is a streams option resolved against the source: the
+// position of the chosen video stream among the video streams and the chosen
+// audio streams in output order.
+type streamSelection struct {
+	Video int
+	Audio []AudioTrack
+}
+
+func parseStreamSelection(value string) ([]int, error) {
+	var indices []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("%q is not a stream index", field)
+		}
+		if !seen[index] {
+			seen[index] = true
+			indices = append(indices, index)
+		}
+	}
+
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("no streams selected")
+	}
+	if len(indices) > maxStreamSelections {
+		return nil, fmt.Errorf("at most %d streams can be selected", maxStreamSelections)
+	}
+	return indices, nil
+}
+
+// resolveStreams checks a selection against the probed streams. Exactly one
+// video stream has to be kept; subtitles have their own options and other
+// stream types can't be encoded.
+func resolveStreams(indices []int, available []StreamInfo) (*streamSelection, error) {
+	selection := &streamSelection{Video: -1}
+	for _, index := range indices {
+		if index >= len(available) {
+			return nil, fmt.Errorf("stream %d not found, the source has %d streams", index, len(available))
+		}
+		stream := available[index]
+
+		// ffmpeg's 0:v:N and 0:a:N specifiers count streams of one type.
+		position := 0
+		for _, other := range available[:index] {
+			if other.Type == stream.Type {
+				position++
+			}
+		}
+
+		switch {
+		case stream.Type == "video" && stream.AttachedPic:
+			return nil, fmt.Errorf("stream %d is cover art, not a video stream", index)
+		case stream.Type == "video":
+			if selection.Video >= 0 {
+				return nil, fmt.Errorf("only one video stream can be selected")
+			}
+			selection.Video = position
+		case stream.Type == "audio":
+			selection.Audio = append(selection.Audio, AudioTrack{
+				Index:    position,
+				Codec:    stream.Codec,
+				Language: stream.Language,
+				Default:  len(selection.Audio) == 0,
+			})
+		default:
+			return nil, fmt.Errorf("stream %d is a %s stream, only video and audio streams can be selected", index, stream.Type)
+		}
+	}
+
+	if selection.Video < 0 {
+		return nil, fmt.Errorf("the selection must include a video stream")
+	}
+	return selection, nil
+}
+
+func streamMapArgs(indices []int) []string {
+	var args []string
+	for _, index := range indices {
+		args = append(args, "-map", fmt.Sprintf("0:%d", index))
+	}
+	return args
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	subtitleModeBurn = "burn"
+	subtitleModeCopy = "copy"
+)
+
+var imageSubtitleCodecs = []string{"hdmv_pgs_subtitle", "dvd_subtitle", "dvb_subtitle", "xsub"}
+
+type SubtitleTrack struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+func (t SubtitleTrack) imageBased() bool {
+	return slices.Contains(imageSubtitleCodecs, t.Codec)
+}
+
+func (o CompressionOptions) subtitleTrack(available []SubtitleTrack) (*SubtitleTrack, error) {
+	if o.Subtitles == "" {
+		return nil, nil
+	}
+	if o.SubtitleTrack >= len(available) {
+		if len(available) == 0 {
+			return nil, fmt.Errorf("the source has no subtitle tracks")
+		}
+		return nil, fmt.Errorf("subtitle track %d not found, the source has %d", o.SubtitleTrack, len(available))
+	}
+
+	track := available[o.SubtitleTrack]
+	if track.imageBased() && o.Subtitles == subtitleModeBurn {
+		return nil, fmt.Errorf("subtitle track %d is image-based (%s) and cannot be burned in", track.Index, track.Codec)
+	}
+	if o.Subtitles == subtitleModeCopy {
+		if _, err := containerSubtitleCodec(o.container(), track); err != nil {
+			return nil, err
+		}
+	}
+	return &track, nil
+}
+
+func containerSubtitleCodec(container string, track SubtitleTrack) (string, error) {
+	switch {
+	case track.imageBased() && container != "mkv":
+		return "", fmt.Errorf("image-based %s subtitles can only be copied into mkv", track.Codec)
+	case container == "mp4":
+		return "mov_text", nil
+	case container == "webm":
+		return "webvtt", nil
+	case track.Codec == "mov_text":
+		return "srt", nil
+	default:
+		return "copy", nil
+	}
+}
+
+// burnSubtitlesFilter renders a text subtitle track of the input onto the
+// video. With a trim the frames are shifted back to source time while the
+// subtitles are drawn, since the filter reads cue times from the file itself.
+func burnSubtitlesFilter(inputPath string, track int, startTime float64) string {
+	filter := fmt.Sprintf("subtitles=filename=%s:si=%d", escapeFilterValue(inputPath), track)
+	if startTime > 0 {
+		return fmt.Sprintf("setpts=PTS+%s/TB,%s,setpts=PTS-STARTPTS", formatSeconds(startTime), filter)
+	}
+	return filter
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// targetSizeOverhead is the share of the target kept free for container
+	// overhead and encoder overshoot.
+	targetSizeOverhead    = 0.03
+	minTargetVideoBitrate = 64_000
+	// Below this many bits per pixel and frame the output turns into a smear
+	// of blocks even with two-pass encoding.
+	minTargetBitsPerPixel = 0.02
+)
+
+func bitrateBits(value string) int64 {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(strings.ToLower(value), "k"):
+		multiplier, value = 1e3, value[:len(value)-1]
+	case strings.HasSuffix(strings.ToLower(value), "m"):
+		multiplier, value = 1e6, value[:len(value)-1]
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+func (o CompressionOptions) outputAudioBitrate(source *VideoMetrics) int64 {
+	if source.AudioCodec == "" || o.AudioMode == audioModeStrip {
+		return 0
+	}
+	tracks := int64(max(len(o.AudioTracks), 1))
+	if o.AudioMode == audioModeCopy || o.AudioCodec == "copy" || (o.AudioMode == "" && o.AudioCodec == "" && settings.AudioCodec == "copy") {
+		return source.AudioBitrate * tracks
+	}
+	if o.AudioBitrate != "" {
+		return bitrateBits(o.AudioBitrate) * tracks
+	}
+	return bitrateBits(settings.AudioBitrate) * tracks
+}
+
+// targetSizeBitrate works out the video bitrate that makes the output of a
+// duration-second clip land just under TargetSizeMB. The warning is set when
+// that bitrate is too low for the output resolution to look acceptable.
+func (o CompressionOptions) targetSizeBitrate(source *VideoMetrics, duration float64, outputHeight int) (int64, string, error) {
+	if duration <= 0 {
+		return 0, "", fmt.Errorf("source duration is unknown, a target size cannot be met")
+	}
+
+	targetBits := o.TargetSizeMB * 1024 * 1024 * 8 * (1 - targetSizeOverhead)
+	audio := o.outputAudioBitrate(source)
+	video := int64(targetBits/duration) - audio
+	if video < minTargetVideoBitrate {
+		return 0, "", fmt.Errorf("%gMB is too small for %ss of video: the audio alone needs %dkbps, leaving %dkbps for video", o.TargetSizeMB, formatSeconds(duration), audio/1000, max(video, 0)/1000)
+	}
+
+	frameRate, _ := strconv.ParseFloat(source.FrameRate, 64)
+	if o.TargetFPS > 0 {
+		frameRate = o.TargetFPS
+	}
+	pixels := float64(scaledWidth(source.Width, source.Height, outputHeight) * outputHeight)
+	warning := ""
+	if frameRate > 0 && pixels > 0 && float64(video)/(pixels*frameRate) < minTargetBitsPerPixel {
+		warning = fmt.Sprintf("targetSizeMB %g leaves only %dkbps for %dp video; expect heavy compression artifacts, or lower the height", o.TargetSizeMB, video/1000, outputHeight)
+	}
+	return video, warning, nil
+}
+
+// expectedEncoder mirrors the encoder choice of buildFFmpegArgs for checks
+// made at upload time, falling back to the CPU when NVENC is unusable.
+func (o CompressionOptions) expectedEncoder() string {
+	if isNVENC(o.Codec) && !gpuAvailable() {
+		return cpuFallbackEncoder(o.Codec)
+	}
+	return o.Codec
+}
+
+// expectedOutputHeight mirrors the height decisions of buildFFmpegArgs for
+// checks made at upload time, before the job is planned.
+func (o CompressionOptions) expectedOutputHeight(source *VideoMetrics) int {
+	targetHeight, _, err := resolveTargetHeight(o.TargetHeight, source)
+	if err != nil {
+		return source.Height
+	}
+	if targetHeight, _ = capTargetHeight(targetHeight, o.MaxHeight, source); targetHeight > 0 {
+		return targetHeight
+	}
+	return source.Height
+}
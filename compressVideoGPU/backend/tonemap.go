@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const toneMapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
+	"tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+var (
+	hdrTransfers = []string{"smpte2084", "arib-std-b67"}
+
+	zscaleOnce      sync.Once
+	zscaleAvailable bool
+)
+
+func supportsToneMapping() bool {
+	zscaleOnce.Do(func() {
+		filters, err := exec.Command(ffmpegPath, "-hide_banner", "-filters").Output()
+		zscaleAvailable = err == nil && strings.Contains(string(filters), "zscale")
+	})
+	return zscaleAvailable
+}
+
+// hdrReason describes the HDR signalling that makes a source need tone
+// mapping, or returns "" for SDR input.
+func hdrReason(metrics *VideoMetrics) string {
+	if !slices.Contains(hdrTransfers, metrics.ColorTransfer) {
+		return ""
+	}
+	return fmt.Sprintf("%s transfer with %s primaries and %s matrix",
+		metrics.ColorTransfer, metrics.ColorPrimaries, metrics.ColorSpace)
+}
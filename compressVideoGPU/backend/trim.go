@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// An output may end slightly early where the last audio or video frame falls,
+// but anything shorter than this means the encode stopped before the end.
+const (
+	truncationTolerance        = 0.05
+	minTruncationToleranceSecs = 2.0
+)
+
+// checkOutputDuration compares the probed output length with the clip that
+// was encoded. ffmpeg occasionally exits 0 after stopping early, which the
+// size of the output alone can't reveal.
+func checkOutputDuration(expected, actual float64) error {
+	if expected <= 0 || actual <= 0 {
+		return nil
+	}
+	if expected-actual > max(expected*truncationTolerance, minTruncationToleranceSecs) {
+		return fmt.Errorf("output is truncated: it is %.1fs long but %.1fs were encoded", actual, expected)
+	}
+	return nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+func (o CompressionOptions) trimmed() bool {
+	return o.StartTime > 0 || o.Duration > 0
+}
+
+func (o CompressionOptions) trimInputArgs() []string {
+	var args []string
+	if o.StartTime > 0 {
+		args = append(args, "-ss", formatSeconds(o.StartTime))
+	}
+	if o.Duration > 0 {
+		args = append(args, "-t", formatSeconds(o.Duration))
+	}
+	return args
+}
+
+func (o CompressionOptions) clipDuration(sourceDuration float64) float64 {
+	if o.Duration > 0 {
+		return o.Duration
+	}
+	return sourceDuration - o.StartTime
+}
+
+func (o CompressionOptions) validateTrim(sourceDuration float64) error {
+	if !o.trimmed() {
+		return nil
+	}
+	if sourceDuration <= 0 {
+		return fmt.Errorf("source duration is unknown, the video cannot be trimmed")
+	}
+	if o.StartTime >= sourceDuration {
+		return fmt.Errorf("startTime %ss is past the end of the %ss video", formatSeconds(o.StartTime), formatSeconds(sourceDuration))
+	}
+	if o.StartTime+o.Duration > sourceDuration {
+		return fmt.Errorf("trim range ends at %ss, past the end of the %ss video", formatSeconds(o.StartTime+o.Duration), formatSeconds(sourceDuration))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+func passLogPath(jobID string) string {
+	return filepath.Join(uploadDir, fmt.Sprintf("%s_passlog", jobID))
+}
+
+func removePassLogs(passLog string) {
+	files, err := filepath.Glob(passLog + "*")
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			slog.Warn("Failed to remove pass log", "path", file, "error", err)
+		}
+	}
+}
+
+func runTwoPassEncode(ctx context.Context, jobID string, p encodeParams, duration float64, niceness int) ([]byte, error) {
+	p.PassLog = passLogPath(jobID)
+	defer removePassLogs(p.PassLog)
+
+	insertJobPhase(jobID, phaseFirstPass, phaseEncoding)
+	setJobPhase(jobID, phaseFirstPass)
+
+	first := p
+	first.Pass = 1
+	args, _ := buildEncodeArgs(first)
+	if output, err := runFFmpegWithProgress(ctx, jobID, args, duration, niceness); err != nil {
+		return output, err
+	}
+
+	setJobPhase(jobID, phaseEncoding)
+
+	second := p
+	second.Pass = 2
+	args, _ = buildEncodeArgs(second)
+	return runFFmpegWithProgress(ctx, jobID, args, duration, niceness)
+}
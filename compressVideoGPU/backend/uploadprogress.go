@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const uploadIDHeader = "X-Upload-ID"
+
+// UploadProgress counts the received bytes atomically, so the body reader
+// never takes jobMutex for a read that does not move the percentage.
+type UploadProgress struct {
+	Total    int64
+	received atomic.Int64
+}
+
+func (u *UploadProgress) Received() int64 {
+	return u.received.Load()
+}
+
+func (u *UploadProgress) percent() int {
+	if u.Total <= 0 {
+		return 0
+	}
+	return int(min(u.Received()*100/u.Total, 100))
+}
+
+// uploadCounter counts the request body as the multipart parser reads it, so
+// the placeholder job can report how far the receive has come.
+type uploadCounter struct {
+	io.ReadCloser
+	jobID    string
+	progress *UploadProgress
+}
+
+func (r *uploadCounter) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		before := r.progress.percent()
+		r.progress.received.Add(int64(n))
+		if r.progress.percent() != before {
+			notifyUploadProgress(r.jobID)
+		}
+	}
+	return n, err
+}
+
+// trackUpload registers a job in status "uploading" under the client's
+// X-Upload-ID, a UUID picked before sending the request, so /status and
+// /events can follow the receive of a large upload. It returns "" when the
+// client sent no ID and false once it has written an error response.
+func trackUpload(c *gin.Context) (string, bool) {
+	uploadID := c.GetHeader(uploadIDHeader)
+	if uploadID == "" {
+		return "", true
+	}
+	if _, err := uuid.Parse(uploadID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid " + uploadIDHeader,
+			"details": err.Error(),
+		})
+		return "", false
+	}
+
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if _, exists := jobsByID[uploadID]; exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": uploadIDHeader + " is already in use",
+		})
+		return "", false
+	}
+	progress := &UploadProgress{Total: c.Request.ContentLength}
+	jobsByID[uploadID] = &Job{
+		ID:      uploadID,
+		Status:  "uploading",
+		Created: time.Now(),
+		Upload:  progress,
+	}
+	c.Request.Body = &uploadCounter{ReadCloser: c.Request.Body, jobID: uploadID, progress: progress}
+	return uploadID, true
+}
+
+// notifyUploadProgress wakes event subscribers, at most once per percent of
+// the upload.
+func notifyUploadProgress(jobID string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok && job.Status == "uploading" {
+		notifyJobLocked(jobID)
+	}
+}
+
+func getJobUpload(jobID string) *UploadProgress {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	if job, ok := jobsByID[jobID]; ok {
+		return job.Upload
+	}
+	return nil
+}
+
+// finishUpload drops the placeholder when the upload did not turn into a
+// queued job under the same ID: a rejected upload, a batch or a duplicate.
+// Event subscribers get a final event without a status.
+func finishUpload(jobID string) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+	if job, ok := jobsByID[jobID]; ok && job.Status == "uploading" {
+		delete(jobsByID, jobID)
+		notifyJobLocked(jobID)
+	}
+}
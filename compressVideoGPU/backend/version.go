@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD)".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+var (
+	ffmpegInfoOnce   sync.Once
+	ffmpegInfo       toolCheck
+	nvencEncoders    []string
+	losslessEncoders map[string]bool
+)
+
+// buildCommit falls back to the VCS revision Go stamps into binaries built
+// inside a git checkout.
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// parseNVENCEncoders picks the NVENC encoders from `ffmpeg -encoders`, whose
+// lines read " V....D h264_nvenc           NVIDIA NVENC H.264 encoder".
+func parseNVENCEncoders(output string) []string {
+	encoders := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.HasSuffix(fields[1], "_nvenc") {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
+
+// ffmpegBuildInfo probes ffmpeg once, at startup, for its version, its NVENC
+// encoders and which of those offer a lossless preset.
+func ffmpegBuildInfo() (toolCheck, []string) {
+	ffmpegInfoOnce.Do(func() {
+		ffmpegInfo = checkTool(ffmpegPath)
+		nvencEncoders = []string{}
+		losslessEncoders = make(map[string]bool)
+		if output, err := exec.Command(ffmpegPath, "-hide_banner", "-encoders").Output(); err == nil {
+			nvencEncoders = parseNVENCEncoders(string(output))
+		}
+		for _, encoder := range nvencEncoders {
+			output, err := exec.Command(ffmpegPath, "-hide_banner", "-h", "encoder="+encoder).CombinedOutput()
+			losslessEncoders[encoder] = err == nil && strings.Contains(string(output), "lossless")
+		}
+	})
+	return ffmpegInfo, nvencEncoders
+}
+
+func handleVersion(c *gin.Context) {
+	ffmpeg, encoders := ffmpegBuildInfo()
+	c.JSON(http.StatusOK, gin.H{
+		"version":       version,
+		"commit":        buildCommit(),
+		"goVersion":     runtime.Version(),
+		"ffmpeg":        ffmpeg,
+		"nvenc":         len(encoders) > 0,
+		"nvencEncoders": encoders,
+		"gpu":           gpuAvailable(),
+	})
+}
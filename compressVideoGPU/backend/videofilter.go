@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	maxVideoFilterLength  = 512
+	maxVideoFilterEntries = 10
+)
+
+// videoFilterAllowlist holds filters that only transform frames. Anything
+// that can read files (movie, subtitles, curves with psfile, drawtext with
+// textfile), take commands at runtime (sendcmd, zmq) or change the pixel
+// format the encoder expects is left out, and so are scale, pad and rotate,
+// whose output size is arbitrary and would get around maxHeight.
+var videoFilterAllowlist = []string{
+	"boxblur", "colorbalance", "colorlevels", "colortemperature", "crop", "deband",
+	"deflicker", "edgedetect", "eq", "fade", "gblur", "hflip", "hue", "lutyuv",
+	"negate", "noise", "setdar", "setsar", "transpose", "unsharp", "vflip", "vignette",
+}
+
+var (
+	videoFilterNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// Arguments are plain options and expressions. Quotes, backslashes,
+	// brackets and semicolons are what ffmpeg's graph syntax uses to escape
+	// out of a filter, label pads or start another chain, so none of them
+	// are accepted.
+	videoFilterArgsPattern = regexp.MustCompile(`^[A-Za-z0-9_.:=+\-*/() ]*$`)
+)
+
+// parseVideoFilter checks a user-supplied -vf chain: comma-separated filters,
+// each a name from the allowlist with optional "=" arguments. It returns the
+// chain as it will be passed to ffmpeg.
+func parseVideoFilter(value string) (string, error) {
+	if len(value) > maxVideoFilterLength {
+		return "", fmt.Errorf("the chain is longer than %d characters", maxVideoFilterLength)
+	}
+
+	entries := strings.Split(value, ",")
+	if len(entries) > maxVideoFilterEntries {
+		return "", fmt.Errorf("at most %d filters can be chained", maxVideoFilterEntries)
+	}
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		name, args, _ := strings.Cut(entry, "=")
+		switch {
+		case name == "":
+			return "", fmt.Errorf("filter %d is empty", i+1)
+		case !videoFilterNamePattern.MatchString(name) || !slices.Contains(videoFilterAllowlist, name):
+			return "", fmt.Errorf("filter %q is not allowed, must be one of %s", name, strings.Join(videoFilterAllowlist, ", "))
+		case !videoFilterArgsPattern.MatchString(args):
+			return "", fmt.Errorf("arguments of %s may only contain letters, digits, spaces and _ . : = + - * / ( )", name)
+		}
+		entries[i] = entry
+	}
+	return strings.Join(entries, ","), nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseVideoFilter(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"eq=brightness=0.05:saturation=1.2, hflip", "eq=brightness=0.05:saturation=1.2,hflip", false},
+		{"crop=iw/2:ih/2", "crop=iw/2:ih/2", false},
+		{"scale=100000:100000", "", true},
+		{"pad=20000:20000", "", true},
+		{"rotate=PI/4:ow=50000:oh=50000", "", true},
+		{"movie=/etc/passwd", "", true},
+		{"eq=contrast='2'", "", true},
+		{"hflip;[in]vflip", "", true},
+		{"hflip,,vflip", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseVideoFilter(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseVideoFilter(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultFontFile          = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	maxTextWatermarkLength   = 200
+	defaultTextWatermarkSize = 24
+	maxImageWatermarkSize    = 2 * 1024 * 1024
+)
+
+var watermarkPositions = map[string]string{
+	"top-left":     "x=10:y=10",
+	"top-right":    "x=w-tw-10:y=10",
+	"bottom-left":  "x=10:y=h-th-10",
+	"bottom-right": "x=w-tw-10:y=h-th-10",
+	"center":       "x=(w-tw)/2:y=(h-th)/2",
+}
+
+var overlayPositions = map[string]string{
+	"top-left":     "x=10:y=10",
+	"top-right":    "x=W-w-10:y=10",
+	"bottom-left":  "x=10:y=H-h-10",
+	"bottom-right": "x=W-w-10:y=H-h-10",
+	"center":       "x=(W-w)/2:y=(H-h)/2",
+}
+
+var imageWatermarkFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+}
+
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+var filterValueEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	`:`, `\:`,
+	`,`, `\,`,
+	`;`, `\;`,
+	`[`, `\[`,
+	`]`, `\]`,
+)
+
+type ImageWatermark struct {
+	Position string `json:"position"`
+	Format   string `json:"format"`
+}
+
+type TextWatermark struct {
+	Text     string  `json:"text"`
+	Position string  `json:"position"`
+	FontSize int     `json:"fontSize"`
+	Color    string  `json:"color"`
+	Opacity  float64 `json:"opacity"`
+}
+
+func (w *TextWatermark) validate() error {
+	w.Text = sanitizeWatermarkText(w.Text)
+	if w.Text == "" {
+		return fmt.Errorf("text watermark is empty after removing control characters")
+	}
+	if _, ok := watermarkPositions[w.Position]; !ok {
+		return fmt.Errorf("invalid position %q", w.Position)
+	}
+	if w.FontSize < 8 || w.FontSize > 200 {
+		return fmt.Errorf("font size must be between 8 and 200, got %d", w.FontSize)
+	}
+	if !colorPattern.MatchString(w.Color) {
+		return fmt.Errorf("invalid color %q: use a color name or #RRGGBB", w.Color)
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("opacity must be between 0 and 1, got %g", w.Opacity)
+	}
+	return nil
+}
+
+func sanitizeWatermarkText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > maxTextWatermarkLength {
+		text = string(runes[:maxTextWatermarkLength])
+	}
+	return text
+}
+
+func fontFile() string {
+	if path := os.Getenv("FONT_FILE"); path != "" {
+		return path
+	}
+	return defaultFontFile
+}
+
+func escapeFilterValue(value string) string {
+	return filterValueEscaper.Replace(value)
+}
+
+func watermarkTextPath(jobID string) string {
+	return filepath.Join(uploadDir, fmt.Sprintf("%s_watermark.txt", jobID))
+}
+
+func writeWatermarkText(jobID string, w *TextWatermark) error {
+	if err := os.WriteFile(watermarkTextPath(jobID), []byte(w.Text), 0644); err != nil {
+		return fmt.Errorf("failed to write watermark text: %v", err)
+	}
+	return nil
+}
+
+// drawTextFilter reads the watermark text from a file next to the upload so the
+// user-supplied text never becomes part of the filter graph itself.
+func drawTextFilter(textPath string, w *TextWatermark) string {
+	return fmt.Sprintf("drawtext=fontfile=%s:textfile=%s:expansion=none:fontsize=%d:fontcolor=%s@%.2f:%s",
+		escapeFilterValue(fontFile()),
+		escapeFilterValue(textPath),
+		w.FontSize,
+		escapeFilterValue(w.Color),
+		w.Opacity,
+		watermarkPositions[w.Position],
+	)
+}
+
+func readImageWatermark(file *multipart.FileHeader, position string) (*ImageWatermark, []byte, error) {
+	if _, ok := overlayPositions[position]; !ok {
+		return nil, nil, fmt.Errorf("invalid position %q", position)
+	}
+	if file.Size > maxImageWatermarkSize {
+		return nil, nil, fmt.Errorf("image is larger than %dKB", maxImageWatermarkSize/1024)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxImageWatermarkSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) > maxImageWatermarkSize {
+		return nil, nil, fmt.Errorf("image is larger than %dKB", maxImageWatermarkSize/1024)
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := imageWatermarkFormats[contentType]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported image type %s: must be PNG or JPEG", contentType)
+	}
+	return &ImageWatermark{Position: position, Format: format}, data, nil
+}
+
+func imageWatermarkPath(jobID string, w *ImageWatermark) string {
+	return filepath.Join(uploadDir, fmt.Sprintf("%s_watermark.%s", jobID, w.Format))
+}
+
+func saveImageWatermark(jobID string, w *ImageWatermark, data []byte) error {
+	return os.WriteFile(imageWatermarkPath(jobID, w), data, 0644)
+}
+
+// overlayGraph builds the filter_complex for an image watermark on input 1. When
+// label is set the result is exposed under it for an explicit -map.
+func overlayGraph(filters []string, input, position, label string) string {
+	graph := fmt.Sprintf("[%s][1:v]", input)
+	if len(filters) > 0 {
+		graph = fmt.Sprintf("[%s]%s[base];[base][1:v]", input, strings.Join(filters, ","))
+	}
+	graph += "overlay=" + overlayPositions[position]
+	if label != "" {
+		graph += "[" + label + "]"
+	}
+	return graph
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	webhookAttempts        = 5
+	webhookInitialBackoff  = time.Second
+	webhookTimeout         = 10 * time.Second
+	webhookSignatureHeader = "X-Signature-256"
+)
+
+var webhookClient = &http.Client{
+	Transport:     remoteClient.Transport,
+	CheckRedirect: remoteClient.CheckRedirect,
+	Timeout:       webhookTimeout,
+}
+
+func webhookSecret() string {
+	return os.Getenv("WEBHOOK_SECRET")
+}
+
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendJobCallback(jobID, callbackURL string) {
+	body, err := json.Marshal(jobStatusResponse(jobID, getJobStatus(jobID)))
+	if err != nil {
+		jobLogger(jobID).Error("Failed to encode callback", "error", err)
+		return
+	}
+	signature := signWebhook(body, webhookSecret())
+
+	backoff := webhookInitialBackoff
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		retry, err := postWebhook(callbackURL, body, signature)
+		if err == nil {
+			jobLogger(jobID).Info("Delivered callback", "event", "callback_delivered")
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			jobLogger(jobID).Error("Giving up on callback", "event", "callback_failed", "attempts", attempt, "error", err)
+			return
+		}
+
+		jobLogger(jobID).Warn("Callback failed, retrying", "attempt", attempt, "backoff", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(callbackURL string, body []byte, signature string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookSignatureHeader, signature)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("receiver responded with %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+}
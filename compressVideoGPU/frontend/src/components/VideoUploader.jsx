@@ -5,6 +5,12 @@ import './VideoUploader.css';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || (import.meta.env.DEV ? 'http://localhost:8080' : '');
 
+// The API key is entered by the user and kept for the browser session only,
+// so it never ends up in the built frontend.
+const API_KEY_STORAGE = 'apiKey';
+
+const apiKeyHeaders = (apiKey) => (apiKey ? { 'X-API-Key': apiKey } : {});
+
 const VideoUploader = () => {
   const [selectedFile, setSelectedFile] = useState(null);
   const [uploadPercentage, setUploadPercentage] = useState(0);
@@ -14,9 +20,12 @@ const VideoUploader = () => {
   
   const [jobID, setJobID] = useState(null);
   const [jobStatus, setJobStatus] = useState(null); 
+  const [queuePosition, setQueuePosition] = useState(null);
+  const [failureReason, setFailureReason] = useState(null);
   const [downloadURL, setDownloadURL] = useState(null);
   const [videoMetrics, setVideoMetrics] = useState(null);
   const [originalVideoURL, setOriginalVideoURL] = useState(null);
+  const [apiKey, setApiKey] = useState(() => sessionStorage.getItem(API_KEY_STORAGE) || '');
 
   
   useEffect(() => {
@@ -26,13 +35,20 @@ const VideoUploader = () => {
 
     const pollStatus = async () => {
       try {
-        const response = await axios.get(`${API_BASE_URL}/status/${jobID}`);
+        const response = await axios.get(`${API_BASE_URL}/status/${jobID}`, {
+          headers: apiKeyHeaders(apiKey),
+        });
         setJobStatus(response.data.status);
+        setQueuePosition(response.data.queuePosition ?? null);
 
         if (response.data.status === 'complete') {
           setDownloadURL(response.data.downloadURL);
           setVideoMetrics(response.data.metrics);
         }
+
+        if (response.data.status === 'failed') {
+          setFailureReason(response.data.error ?? null);
+        }
       } catch (err) {
         console.error('Status polling error:', err);
         setError('Failed to check compression status');
@@ -45,7 +61,7 @@ const VideoUploader = () => {
 
     
     return () => clearInterval(interval);
-  }, [jobID, jobStatus]);
+  }, [jobID, jobStatus, apiKey]);
   useEffect(() => {
     const fetchPodName = async () => {
       try {
@@ -59,6 +75,16 @@ const VideoUploader = () => {
     };
     fetchPodName();
   }, []);
+  const handleApiKeyChange = (event) => {
+    const value = event.target.value.trim();
+    setApiKey(value);
+    if (value) {
+      sessionStorage.setItem(API_KEY_STORAGE, value);
+    } else {
+      sessionStorage.removeItem(API_KEY_STORAGE);
+    }
+  };
+
   const handleFileSelect = (event) => {
     const file = event.target.files[0];
     if (file) {
@@ -106,6 +132,7 @@ const VideoUploader = () => {
       const response = await axios.post(`${API_BASE_URL}/upload`, formData, {
         headers: {
           'Content-Type': 'multipart/form-data',
+          ...apiKeyHeaders(apiKey),
         },
         onUploadProgress: (progressEvent) => {
           const percentCompleted = Math.round(
@@ -117,7 +144,8 @@ const VideoUploader = () => {
 
       
       setJobID(response.data.jobID);
-      setJobStatus('processing');
+      setJobStatus(response.data.status || 'processing');
+      setQueuePosition(response.data.queuePosition ?? null);
       console.log('Upload successful, job ID:', response.data.jobID);
     } catch (err) {
       console.error('Upload error:', err);
@@ -142,6 +170,7 @@ const VideoUploader = () => {
     setDownloadURL(null);
     setError(null);
     setVideoMetrics(null);
+    setFailureReason(null);
     
     
     if (originalVideoURL) {
@@ -151,13 +180,19 @@ const VideoUploader = () => {
   };
 
   const formatFileSize = (bytes) => {
-    if (bytes === 0) return '0 Bytes';
+    if (!bytes) return '0 Bytes';
+    const sign = bytes < 0 ? '-' : '';
+    const size = Math.abs(bytes);
     const k = 1024;
     const sizes = ['Bytes', 'KB', 'MB', 'GB'];
-    const i = Math.floor(Math.log(bytes) / Math.log(k));
-    return Math.round(bytes / Math.pow(k, i) * 100) / 100 + ' ' + sizes[i];
+    const i = Math.min(Math.max(Math.floor(Math.log(size) / Math.log(k)), 0), sizes.length - 1);
+    return sign + Math.round(size / Math.pow(k, i) * 100) / 100 + ' ' + sizes[i];
   };
 
+  // Remuxing copies the streams, so the output can come out the same size or
+  // slightly larger than the original.
+  const sizeGrew = (metrics) => parseFloat(metrics.compressionRatio) < 0;
+
   const formatDuration = (seconds) => {
     if (!seconds || seconds === 0) return '0:00';
     const hrs = Math.floor(seconds / 3600);
@@ -185,6 +220,19 @@ const VideoUploader = () => {
       <p className="subtitle">Upload your video to compress it using GPU acceleration</p>
       {podName && <p className="pod-name">Served by Pod: <strong>{podName}</strong></p>}
       <div className="upload-container">
+        <div className="api-key-input">
+          <label htmlFor="api-key">API key</label>
+          <input
+            type="password"
+            id="api-key"
+            value={apiKey}
+            onChange={handleApiKeyChange}
+            placeholder="Leave empty if the server does not require one"
+            autoComplete="off"
+            disabled={uploading}
+          />
+        </div>
+
         <div className="file-input-wrapper">
           <input
             type="file"
@@ -230,6 +278,16 @@ const VideoUploader = () => {
         )}
 
         
+        {jobStatus === 'queued' && (
+          <div className="processing-message">
+            <div className="spinner"></div>
+            <h3>Waiting in Queue...</h3>
+            <p>Your video will be compressed as soon as a worker is free.</p>
+            {queuePosition && <p>Queue position: {queuePosition}</p>}
+            <p className="job-id">Job ID: {jobID}</p>
+          </div>
+        )}
+
         {jobStatus === 'processing' && (
           <div className="processing-message">
             <div className="spinner"></div>
@@ -291,10 +349,10 @@ const VideoUploader = () => {
                         <span className="metric-value compressed">{formatFileSize(videoMetrics.compressed.size)}</span>
                       </div>
                       <div className="metric-item highlight">
-                        <span className="metric-label">Size Reduction:</span>
+                        <span className="metric-label">{sizeGrew(videoMetrics) ? 'Size Increase:' : 'Size Reduction:'}</span>
                         <span className="metric-value savings">
-                          {formatFileSize(videoMetrics.original.size - videoMetrics.compressed.size)} 
-                          ({videoMetrics.compressionRatio}%)
+                          {formatFileSize(Math.abs(videoMetrics.original.size - videoMetrics.compressed.size))} 
+                          ({Math.abs(parseFloat(videoMetrics.compressionRatio)).toFixed(2)}%)
                         </span>
                       </div>
                     </div>
@@ -390,8 +448,8 @@ const VideoUploader = () => {
                       <div className="stat-box">
                         <div className="stat-icon">📉</div>
                         <div className="stat-content">
-                          <div className="stat-label">Space Saved</div>
-                          <div className="stat-value">{videoMetrics.compressionRatio}%</div>
+                          <div className="stat-label">{sizeGrew(videoMetrics) ? 'Size Increase' : 'Space Saved'}</div>
+                          <div className="stat-value">{Math.abs(parseFloat(videoMetrics.compressionRatio)).toFixed(2)}%</div>
                         </div>
                       </div>
                       <div className="stat-box">
@@ -429,12 +487,18 @@ const VideoUploader = () => {
         {jobStatus === 'failed' && (
           <div className="error-message">
             <h3>Compression Failed</h3>
-            <p>The video compression process failed. This could be due to:</p>
-            <ul>
-              <li>Unsupported video format</li>
-              <li>Corrupted video file</li>
-              <li>Server processing error</li>
-            </ul>
+            {failureReason ? (
+              <p>{failureReason.message}</p>
+            ) : (
+              <>
+                <p>The video compression process failed. This could be due to:</p>
+                <ul>
+                  <li>Unsupported video format</li>
+                  <li>Corrupted video file</li>
+                  <li>Server processing error</li>
+                </ul>
+              </>
+            )}
             <button className="reset-button" onClick={handleReset}>
               Try Again
             </button>